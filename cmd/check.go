@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kkentzo/rv/release"
+	"github.com/spf13/cobra"
+)
+
+func CheckCommand() *cobra.Command {
+	var (
+		// command-line arguments
+		archivePath string
+		format      string
+		download    release.DownloadOptions
+		opts        release.ExtractOptions
+		descr       = "Validate the specified archive without extracting it"
+		cmd         = &cobra.Command{
+			Use:   "check",
+			Short: descr,
+			Long:  descr,
+			PreRunE: func(cmd *cobra.Command, args []string) error {
+				if err := validateDownloadFlags(archivePath, &download); err != nil {
+					return err
+				}
+				return validateContentFlags(&opts)
+			},
+			Run: func(cmd *cobra.Command, args []string) {
+				src := newArchiveSource(archivePath, format, cmd.InOrStdin(), download)
+				if err := release.Check(src, opts, cmd.OutOrStdout()); err != nil {
+					fmt.Fprintf(cmd.OutOrStderr(), "error: %v\n", err)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "[success] %s is valid\n", src)
+				}
+			},
+		}
+	)
+
+	cmd.Flags().StringVarP(&archivePath, "archive", "a", "", "path or HTTP(S) URL of archive file to check (use - for standard input)")
+	cmd.Flags().StringVar(&format, "format", "", fmt.Sprintf("archive format (%s); detected from the archive's contents if omitted", strings.Join(release.SupportedFormats(), ", ")))
+	addDownloadFlags(cmd, &download)
+	addContentFlags(cmd, &opts)
+	cmd.MarkFlagRequired("archive")
+
+	return cmd
+}
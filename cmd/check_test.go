@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Check_ShouldAcceptValidBundle(t *testing.T) {
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt", "bar.txt"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"check", "-a", bundlePath})
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "[check] entries=2 ")
+	assert.Contains(t, out.String(), fmt.Sprintf("[success] bundle=%s is valid", bundlePath))
+}
+
+func Test_Check_ShouldNotPrintPasswordsOfURLs(t *testing.T) {
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt"))
+	contents, err := os.ReadFile(bundlePath)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(contents)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/bundle.zip")
+	require.NoError(t, err)
+	u.User = url.UserPassword("user", "secret")
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"check", "-a", u.String()})
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "[success] bundle="+u.Redacted()+" is valid")
+	assert.NotContains(t, out.String(), "secret")
+}
+
+func Test_Check_ShouldRejectBundleThatExceedsLimits(t *testing.T) {
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt", "bar.txt"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"check", "-a", bundlePath, "--max-files", "1"})
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "error: invalid archive")
+	assert.Contains(t, out.String(), "archive exceeds the maximum number of entries (1)")
+	assert.NotContains(t, out.String(), "[success]")
+}
@@ -97,7 +97,7 @@ func fileExists(filename string) bool {
 	return !os.IsNotExist(err)
 }
 
-func createBundle(zipFileName, includedFileName string) error {
+func createBundle(zipFileName string, includedFileNames ...string) error {
 	outFile, err := os.Create(zipFileName)
 	if err != nil {
 		return err
@@ -105,8 +105,10 @@ func createBundle(zipFileName, includedFileName string) error {
 
 	w := zip.NewWriter(outFile)
 
-	if _, err := w.Create(includedFileName); err != nil {
-		return fmt.Errorf("failed to include %s to zip file", zipFileName)
+	for _, includedFileName := range includedFileNames {
+		if _, err := w.Create(includedFileName); err != nil {
+			return fmt.Errorf("failed to include %s to zip file", zipFileName)
+		}
 	}
 
 	if err := w.Close(); err != nil {
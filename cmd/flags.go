@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kkentzo/rv/release"
+	"github.com/spf13/cobra"
+)
+
+// add the flags that determine which contents of an archive are extracted
+// (and how much of them) to the commands that read archives
+func addContentFlags(cmd *cobra.Command, opts *release.ExtractOptions) {
+	cmd.Flags().Var(newSizeValue(release.DefaultLimits.MaxTotalSize, &opts.Limits.MaxTotalSize), "max-size", "maximum total size of the extracted archive contents (0 for no limit)")
+	cmd.Flags().Var(newSizeValue(release.DefaultLimits.MaxFileSize, &opts.Limits.MaxFileSize), "max-file-size", "maximum size of a single extracted file (0 for no limit)")
+	cmd.Flags().Int64Var(&opts.Limits.MaxFiles, "max-files", release.DefaultLimits.MaxFiles, "maximum number of entries in the archive (0 for no limit)")
+	cmd.Flags().Float64Var(&opts.Limits.MaxRatio, "max-ratio", release.DefaultLimits.MaxRatio, "maximum ratio of extracted size to archive size (0 for no limit)")
+	cmd.Flags().IntVar(&opts.StripComponents, "strip-components", 0, "remove the specified number of leading path components from archive entries")
+	cmd.Flags().StringVar(&opts.SubPath, "sub-path", "", "extract only the contents of the specified directory of the archive (e.g. opt/vendor/app)")
+	cmd.Flags().StringArrayVar(&opts.Include, "include", nil, "extract only the files that match the glob pattern (can be repeated)")
+	cmd.Flags().StringArrayVar(&opts.Exclude, "exclude", nil, "do not extract the entries that match the glob pattern (can be repeated)")
+}
+
+func validateContentFlags(opts *release.ExtractOptions) error {
+	if opts.StripComponents < 0 {
+		return errors.New("negative values are not valid for --strip-components flag")
+	}
+	if path.IsAbs(opts.SubPath) || contains(strings.Split(opts.SubPath, "/"), "..") {
+		return errors.New("--sub-path must be a relative path inside the archive")
+	}
+	return nil
+}
+
+// add the flags that control how archives are downloaded from HTTP(S) URLs
+func addDownloadFlags(cmd *cobra.Command, opts *release.DownloadOptions) {
+	cmd.Flags().StringVar(&opts.SHA256, "sha256", "", "the expected sha256 checksum of the archive (URLs only)")
+	cmd.Flags().Var(newHeaderValue(&opts.Header), "header", "add the header (e.g. 'Authorization: Bearer ...') to the archive's download requests (can be repeated)")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 3, "number of times to retry a failed download (URLs only)")
+}
+
+func validateDownloadFlags(archivePath string, opts *release.DownloadOptions) error {
+	if !release.IsURL(archivePath) && (opts.SHA256 != "" || len(opts.Header) > 0) {
+		return errors.New("--sha256 and --header can only be used when the archive is a URL")
+	}
+	if b, err := hex.DecodeString(opts.SHA256); err != nil || (opts.SHA256 != "" && len(b) != 32) {
+		return fmt.Errorf("invalid sha256 checksum %q", opts.SHA256)
+	}
+	if opts.Retries < 0 {
+		return errors.New("negative values are not valid for --retries flag")
+	}
+	return nil
+}
+
+// create the source of the archive at `archivePath`, which can also be a URL
+func newArchiveSource(archivePath, format string, stdin io.Reader, opts release.DownloadOptions) release.Source {
+	if release.IsURL(archivePath) {
+		return release.NewURLSource(archivePath, format, opts)
+	}
+	return release.NewArchiveSource(archivePath, format, stdin)
+}
+
+// the multipliers of the suffixes accepted by size flags
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+}
+
+// sizeValue is a flag value that holds a number of bytes, which
+// can be specified with a binary suffix (e.g. 512K, 100M, 2G)
+type sizeValue int64
+
+func newSizeValue(val int64, p *int64) *sizeValue {
+	*p = val
+	return (*sizeValue)(p)
+}
+
+func (s *sizeValue) Set(val string) error {
+	val = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(val)), "B")
+	multiplier := int64(1)
+	for _, suffix := range sizeSuffixes {
+		if strings.HasSuffix(val, suffix.suffix) {
+			val = strings.TrimSuffix(val, suffix.suffix)
+			multiplier = suffix.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", val)
+	}
+	*s = sizeValue(n * multiplier)
+	return nil
+}
+
+func (s *sizeValue) String() string {
+	n := int64(*s)
+	for idx := len(sizeSuffixes) - 1; idx >= 0; idx-- {
+		if m := sizeSuffixes[idx].multiplier; n != 0 && n%m == 0 {
+			return fmt.Sprintf("%d%s", n/m, sizeSuffixes[idx].suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func (s *sizeValue) Type() string {
+	return "size"
+}
+
+// umaskValue is a flag value that holds an (optional) octal umask
+type umaskValue struct {
+	p **os.FileMode
+}
+
+func newUmaskValue(p **os.FileMode) *umaskValue {
+	return &umaskValue{p: p}
+}
+
+func (u *umaskValue) Set(val string) error {
+	n, err := strconv.ParseUint(strings.TrimSpace(val), 8, 32)
+	if err != nil || n > 0777 {
+		return fmt.Errorf("invalid umask %q", val)
+	}
+	mask := os.FileMode(n)
+	*u.p = &mask
+	return nil
+}
+
+func (u *umaskValue) String() string {
+	if *u.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%03o", uint32(**u.p))
+}
+
+func (u *umaskValue) Type() string {
+	return "octal"
+}
+
+// headerValue is a flag value that adds "Name: value" headers to an http.Header
+type headerValue struct {
+	h *http.Header
+}
+
+func newHeaderValue(h *http.Header) *headerValue {
+	return &headerValue{h: h}
+}
+
+func (v *headerValue) Set(val string) error {
+	name, value, ok := strings.Cut(val, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid header %q (expected 'Name: value')", val)
+	}
+	if *v.h == nil {
+		*v.h = http.Header{}
+	}
+	v.h.Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// the headers' values (e.g. credentials) are not shown
+func (v *headerValue) String() string {
+	names := []string{}
+	for name := range *v.h {
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (v *headerValue) Type() string {
+	return "header"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
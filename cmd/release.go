@@ -3,6 +3,9 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/kkentzo/rv/release"
 	"github.com/spf13/cobra"
@@ -11,23 +14,45 @@ import (
 func ReleaseCommand(globals *GlobalVariables) *cobra.Command {
 	var (
 		// command-line arguments
-		archivePath         string
-		keepN               uint
-		username, groupname string
-		descr               = "Uncompress the specified archive into the workspace and update the `current` link"
-		cmd                 = &cobra.Command{
+		archivePath string
+		format      string
+		sourceDir   string
+		ociRef      string
+		gitRepo     string
+		gitRef      string
+		download    release.DownloadOptions
+		opts        release.InstallOptions
+		descr       = "Uncompress the specified archive (or copy the specified directory, image or git tree) into the workspace and update the `current` link"
+		cmd         = &cobra.Command{
 			Use:   "release",
 			Short: descr,
 			Long:  descr,
 			PreRunE: func(cmd *cobra.Command, args []string) error {
-				if keepN == 0 {
+				if opts.KeepN == 0 {
 					return errors.New("zero is not a valid value for --keep (-k) flag")
 				}
-				return nil
+				if format != "" && archivePath == "" {
+					return errors.New("--format can only be used with --archive")
+				}
+				if err := validateDownloadFlags(archivePath, &download); err != nil {
+					return err
+				}
+				return validateContentFlags(&opts.ExtractOptions)
 			},
 			Run: func(cmd *cobra.Command, args []string) {
+				// figure out where the release's contents come from
+				var src release.Source
+				if sourceDir != "" {
+					src = release.NewDirectorySource(sourceDir)
+				} else if ociRef != "" {
+					src = release.NewOCISource(ociRef)
+				} else if gitRepo != "" {
+					src = release.NewGitSource(gitRepo, gitRef)
+				} else {
+					src = newArchiveSource(archivePath, format, cmd.InOrStdin(), download)
+				}
 				// perform release
-				releaseID, err := release.Install(globals.WorkspacePath, archivePath, keepN, username, groupname, cmd.OutOrStdout())
+				releaseID, err := release.Install(globals.WorkspacePath, src, opts, cmd.OutOrStdout())
 				if err != nil {
 					fmt.Fprintf(cmd.OutOrStderr(), "error: %v\n", err)
 				} else {
@@ -37,11 +62,27 @@ func ReleaseCommand(globals *GlobalVariables) *cobra.Command {
 		}
 	)
 
-	cmd.Flags().StringVarP(&archivePath, "archive", "a", "", "path to archive file containing the release")
-	cmd.Flags().UintVarP(&keepN, "keep", "k", 3, "maximum number of releases to keep in workspace at all times")
-	cmd.Flags().StringVarP(&username, "user", "u", "", "user to whom all extracted archive files will belong to")
-	cmd.Flags().StringVarP(&groupname, "group", "g", "", "group to whom all extracted archive files will belong to")
-	cmd.MarkFlagRequired("archive")
+	cmd.Flags().StringVarP(&archivePath, "archive", "a", "", "path or HTTP(S) URL of archive file containing the release (use - for standard input)")
+	cmd.Flags().StringVar(&format, "format", "", fmt.Sprintf("archive format (%s); detected from the archive's contents if omitted", strings.Join(release.SupportedFormats(), ", ")))
+	cmd.Flags().UintVarP(&opts.KeepN, "keep", "k", 3, "maximum number of releases to keep in workspace at all times")
+	cmd.Flags().StringVarP(&opts.Username, "user", "u", "", "user to whom all extracted archive files will belong to")
+	cmd.Flags().StringVarP(&opts.Groupname, "group", "g", "", "group to whom all extracted archive files will belong to")
+	cmd.Flags().DurationVar(&opts.LockTimeout, "lock-timeout", time.Minute, "maximum time to wait for other operations on the workspace to finish")
+	addDownloadFlags(cmd, &download)
+	addContentFlags(cmd, &opts.ExtractOptions)
+	cmd.Flags().BoolVar(&opts.AutoUnwrap, "auto-unwrap", false, "if the release contains a single top-level directory, use that directory's contents as the release")
+	cmd.Flags().IntVarP(&opts.Jobs, "jobs", "j", runtime.NumCPU(), "number of files to extract concurrently (zip archives only)")
+	cmd.Flags().BoolVar(&opts.Touch, "touch", false, "do not preserve the modification times of the extracted files")
+	cmd.Flags().BoolVar(&opts.PreserveOwner, "preserve-owner", false, "use the ownership recorded in tar archives instead of --user and --group (requires root)")
+	cmd.Flags().BoolVar(&opts.AllowSpecialBits, "allow-special-bits", false, "keep the setuid, setgid and sticky bits of the extracted files")
+	cmd.Flags().BoolVar(&opts.AllowWorldWritable, "allow-world-writable", false, "keep the world-writable bit of the extracted files")
+	cmd.Flags().Var(newUmaskValue(&opts.Umask), "umask", "apply the specified umask (e.g. 027) to the extracted files instead of the process umask")
+	cmd.Flags().StringVar(&sourceDir, "dir", "", "path to directory containing the release (instead of an archive)")
+	cmd.Flags().StringVar(&ociRef, "oci", "", "path to OCI image layout containing the release as <layout-dir>[:tag] (instead of an archive)")
+	cmd.Flags().StringVar(&gitRepo, "git", "", "path to git repository containing the release (instead of an archive)")
+	cmd.Flags().StringVar(&gitRef, "ref", "HEAD", "the git ref (branch, tag or commit) whose tree will be released (used with --git)")
+	cmd.MarkFlagsOneRequired("archive", "dir", "oci", "git")
+	cmd.MarkFlagsMutuallyExclusive("archive", "dir", "oci", "git")
 
 	return requireGlobalFlags(cmd, globals)
 }
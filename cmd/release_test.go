@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -55,14 +61,8 @@ func Test_Release_ShouldCleanUp_WhenBundleDoesNotExist(t *testing.T) {
 	// check that the output contains the relevant message
 	assert.Contains(t, out.String(), "no such file or directory")
 
-	// the workspace will not be cleared up
-	assert.DirExists(t, workspacePath)
-	// the workspace directory should be empty
-	entries, err := ioutil.ReadDir(workspacePath)
-	assert.NoError(t, err)
-	assert.Empty(t, entries)
-	// the workspace should NOT contain the "current" release link
-	assert.NoFileExists(t, path.Join(workspacePath, release.CurrentLinkName))
+	// the bundle is checked before the workspace is touched
+	assert.NoDirExists(t, workspacePath)
 }
 
 func Test_Release_ShouldUpdateCurrent_WhenPreviousReleaseExists(t *testing.T) {
@@ -122,3 +122,233 @@ func Test_Release_ShouldNotAcceptKeepZeroReleases(t *testing.T) {
 	err := cmd.Execute()
 	assert.ErrorContains(t, err, "zero is not a valid value for --keep (-k) flag")
 }
+
+func Test_Release_ShouldDetectArchiveFormat_WhenArchiveHasNoSuffix(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("artifact-%s", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", bundlePath})
+	require.NoError(t, cmd.Execute())
+
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId)
+	assert.FileExists(t, path.Join(workspacePath, releaseId, "foo.txt"))
+}
+
+func Test_Release_ShouldUseExplicitArchiveFormat(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("artifact-%s", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", bundlePath, "--format", "tar.gz"})
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "invalid archive: failed to read archive")
+	assert.Empty(t, parseReleaseFromOutput(out.String()))
+}
+
+func Test_Release_ShouldCleanUp_WhenArchiveExceedsLimits(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt", "bar.txt"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", bundlePath, "--max-files", "1"})
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "archive exceeds the maximum number of entries (1)")
+	assert.Empty(t, parseReleaseFromOutput(out.String()))
+	// the bundle is checked before the workspace is touched
+	assert.NoDirExists(t, workspacePath)
+}
+
+func Test_Release_FromStdin(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt"))
+	bundle, err := os.Open(bundlePath)
+	require.NoError(t, err)
+	defer bundle.Close()
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetIn(bundle)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", "-", "--format", "zip"})
+	require.NoError(t, cmd.Execute())
+
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId, out.String())
+	assert.FileExists(t, path.Join(workspacePath, releaseId, "foo.txt"))
+}
+
+func Test_Release_FromDirectory(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	sourcePath := uuid.NewString()
+	defer os.RemoveAll(sourcePath)
+	require.NoError(t, os.MkdirAll(path.Join(sourcePath, "foo"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(sourcePath, "foo", "bar.txt"), []byte("bar"), 0644))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "--dir", sourcePath})
+	require.NoError(t, cmd.Execute())
+
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId, out.String())
+	assert.FileExists(t, path.Join(workspacePath, releaseId, "foo", "bar.txt"))
+	assert.FileExists(t, path.Join(workspacePath, release.CurrentLinkName, "foo", "bar.txt"))
+}
+
+func Test_Release_ShouldNotAcceptBothArchiveAndDirectory(t *testing.T) {
+	cmd := New()
+	createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", "workspace", "-a", "foo.zip", "--dir", "foo"})
+	assert.ErrorContains(t, cmd.Execute(), "none of the others can be")
+}
+
+func Test_Release_ShouldNotAcceptFormatWithoutArchive(t *testing.T) {
+	cmd := New()
+	createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", "workspace", "--dir", "foo", "--format", "zip"})
+	assert.ErrorContains(t, cmd.Execute(), "--format can only be used with --archive")
+}
+
+func Test_Release_WithAutoUnwrap(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "myapp-1.2.3/", "myapp-1.2.3/foo.txt", "myapp-1.2.3/bar.txt"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", bundlePath, "--auto-unwrap"})
+	require.NoError(t, cmd.Execute())
+
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId, out.String())
+	assert.Contains(t, out.String(), "unwrapped top-level directory myapp-1.2.3")
+	assert.FileExists(t, path.Join(workspacePath, release.CurrentLinkName, "foo.txt"))
+	assert.FileExists(t, path.Join(workspacePath, release.CurrentLinkName, "bar.txt"))
+}
+
+func Test_Release_WithIncludeAndExclude(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "app.js", "app.js.map", "test.js", "README.md"))
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", bundlePath,
+		"--include", "*.js", "--include", "*.map", "--exclude", "*.map", "--exclude", "test.js"})
+	require.NoError(t, cmd.Execute())
+
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId, out.String())
+	entries, err := ioutil.ReadDir(path.Join(workspacePath, releaseId))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "app.js", entries[0].Name())
+}
+
+func Test_Release_FromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	repoPath := uuid.NewString()
+	defer os.RemoveAll(repoPath)
+	require.NoError(t, os.Mkdir(repoPath, 0755))
+	require.NoError(t, os.WriteFile(path.Join(repoPath, "foo.txt"), []byte("foo"), 0644))
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"commit", "-q", "-m", "first"}, {"tag", "v1"}} {
+		args = append([]string{"-C", repoPath, "-c", "user.name=rv", "-c", "user.email=rv@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	commit, err := exec.Command("git", "-C", repoPath, "rev-parse", "v1").Output()
+	require.NoError(t, err)
+
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "--git", repoPath, "--ref", "v1"})
+	require.NoError(t, cmd.Execute())
+
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId, out.String())
+	assert.FileExists(t, path.Join(workspacePath, releaseId, "foo.txt"))
+
+	list, err := listReleases(workspacePath)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s commit=%s <== current\n", releaseId, strings.TrimSpace(string(commit))), list)
+}
+
+func Test_Release_FromURL(t *testing.T) {
+	workspacePath := uuid.NewString()
+	defer os.RemoveAll(workspacePath)
+
+	bundlePath := fmt.Sprintf("%s.zip", uuid.NewString())
+	defer deleteBundle(bundlePath)
+	require.NoError(t, createBundle(bundlePath, "foo.txt"))
+	contents, err := os.ReadFile(bundlePath)
+	require.NoError(t, err)
+	sum := sha256.Sum256(contents)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write(contents)
+	}))
+	defer srv.Close()
+
+	// the checksum must match the downloaded archive
+	cmd := New()
+	out := createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", srv.URL + "/bundle.zip", "--header", "X-Token: secret", "--sha256", hex.EncodeToString(make([]byte, 32))})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "error: failed to download archive: checksum mismatch")
+	assert.NoDirExists(t, workspacePath)
+
+	// the header authorizes the download
+	cmd = New()
+	out = createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", workspacePath, "-a", srv.URL + "/bundle.zip", "--header", "X-Token: secret", "--sha256", hex.EncodeToString(sum[:])})
+	require.NoError(t, cmd.Execute())
+	releaseId := parseReleaseFromOutput(out.String())
+	require.NotEmpty(t, releaseId, out.String())
+	assert.FileExists(t, path.Join(workspacePath, releaseId, "foo.txt"))
+}
+
+func Test_Release_ShouldRejectDownloadFlagsForLocalArchives(t *testing.T) {
+	cmd := New()
+	createOutputBuffer(cmd)
+	cmd.SetArgs([]string{"release", "-w", uuid.NewString(), "-a", "bundle.zip", "--sha256", hex.EncodeToString(make([]byte, 32))})
+	assert.ErrorContains(t, cmd.Execute(), "--sha256 and --header can only be used when the archive is a URL")
+}
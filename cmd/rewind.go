@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/kkentzo/rv/release"
 	"github.com/spf13/cobra"
@@ -10,7 +11,8 @@ import (
 func RewindCommand(globals *GlobalVariables) *cobra.Command {
 	var (
 		// command-line arguments
-		target string
+		target      string
+		lockTimeout time.Duration
 		// command
 		descr = "Reset the current release"
 		cmd   = &cobra.Command{
@@ -19,7 +21,7 @@ func RewindCommand(globals *GlobalVariables) *cobra.Command {
 			Long:  descr,
 			Run: func(cmd *cobra.Command, args []string) {
 				// perform release
-				releaseID, err := release.Rewind(globals.WorkspacePath, target, cmd.OutOrStdout())
+				releaseID, err := release.Rewind(globals.WorkspacePath, target, lockTimeout, cmd.OutOrStdout())
 				if err != nil {
 					fmt.Fprintf(cmd.OutOrStderr(), "error: %v\n", err)
 				} else {
@@ -30,5 +32,6 @@ func RewindCommand(globals *GlobalVariables) *cobra.Command {
 	)
 
 	cmd.Flags().StringVarP(&target, "target", "t", "", "target release to reset the current link to")
+	cmd.Flags().DurationVar(&lockTimeout, "lock-timeout", time.Minute, "maximum time to wait for other operations on the workspace to finish")
 	return requireGlobalFlags(cmd, globals)
 }
@@ -21,6 +21,7 @@ func New() *cobra.Command {
 	root.AddCommand(ReleaseCommand(globals))
 	root.AddCommand(ListCommand(globals))
 	root.AddCommand(RewindCommand(globals))
+	root.AddCommand(CheckCommand())
 	root.AddCommand(VersionCommand())
 	return root
 }
@@ -4,8 +4,11 @@ go 1.20
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.17.9
 	github.com/spf13/cobra v1.8.0
 	github.com/stretchr/testify v1.9.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/sys v0.30.0
 )
 
 require (
@@ -1,9 +1,7 @@
 package release
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -11,107 +9,488 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-func decompressArchive(archivePath, targetDir string, uid, gid int) error {
-	if strings.HasSuffix(archivePath, ".zip") {
-		return decompressZip(archivePath, targetDir, uid, gid)
-	} else if strings.HasSuffix(archivePath, ".tar.gz") {
-		return decompressTarGzip(archivePath, targetDir, uid, gid)
-	} else {
-		return errors.New("unsupported archive type (supported types: zip, tar.gz)")
+// the path of the bundle that denotes the standard input
+const StdinPath = "-"
+
+const (
+	// symbolic links are followed up to this depth when resolving entry paths
+	maxSymlinkHops = 255
+	// the maximum length of a symbolic link's target (PATH_MAX on linux)
+	maxSymlinkLength = 4096
+	// the mode of the parent directories that are missing from archives
+	implicitDirMode = os.ModeDir | 0755
+)
+
+// target is the directory into which an archive is extracted
+type target struct {
+	root     string
+	uid, gid int
+	opts     ExtractOptions
+	// the (compressed) size of the archive that has been read so far
+	// and the size of the archive files to be read (zero if unknown)
+	archiveSize, archiveTotal int64
+	// the number of entries and bytes extracted so far
+	// (the latter can be updated concurrently by the target's workers)
+	entries, written int64
+	// set when a worker fails so that the rest of the workers stop
+	aborted atomic.Bool
+	// the modification times of the extracted directories, which are
+	// applied after all the directories' contents have been extracted
+	dirModTimes []dirModTime
+	// the symbolic links (name, linkname) that have been extracted so far
+	symlinks [][2]string
+	// the ids of the user and group names found in the archive (see owner)
+	ownersMu          sync.Mutex
+	userIDs, groupIDs map[string]int
+	// the permission bits that have been stripped from the extracted entries
+	stripped strippedBits
+	// set if the entries are only validated (see newDryRunTarget)
+	dryRun *dryRun
+	// the commit from which the contents were exported (git sources only)
+	commit string
+}
+
+func newTarget(root string, uid, gid int, opts ExtractOptions) *target {
+	return &target{
+		root:     root,
+		uid:      uid,
+		gid:      gid,
+		opts:     opts,
+		userIDs:  map[string]int{},
+		groupIDs: map[string]int{},
 	}
 }
 
-func decompressZip(zipFile, targetDir string, uid, gid int) error {
-	// Open the zip archive for reading
-	r, err := zip.OpenReader(zipFile)
-	if err != nil {
+// decompress the archive at `archivePath` (or read from `stdin` if the
+// path is StdinPath) into the target; the archive's format is detected
+// from its contents, unless it is explicitly specified
+func decompressArchive(archivePath, format string, stdin io.Reader, t *target) error {
+	if err := extractArchive(archivePath, format, stdin, t, t); err != nil {
 		return err
 	}
-	defer r.Close()
+	return t.finish()
+}
 
-	// Iterate through each file in the archive
-	for _, f := range r.File {
-		// Open the file inside the zip archive
-		rc, err := f.Open()
+// extract the archive at `archivePath` (see decompressArchive) by adding its
+// entries to `dst`, which is either the target `t` or a wrapper of it
+func extractArchive(archivePath, format string, stdin io.Reader, t *target, dst Target) error {
+	a := &archiveReader{t: t}
+	var input io.Reader
+	if archivePath == StdinPath {
+		input = stdin
+	} else {
+		file, err := os.Open(archivePath)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to open file: %v", err)
 		}
+		defer file.Close()
+		input = file
+		a.file = file
+	}
 
-		// Create the corresponding file in the target directory
-		targetFilePath := filepath.Join(targetDir, f.Name)
-		if f.FileInfo().IsDir() {
-			// Create directories if file is a directory
-			if err := createDirectory(targetFilePath, f.Mode(), uid, gid); err != nil {
-				// close file
-				rc.Close()
-				return err
-			}
-		} else {
-			// Create the file if it doesn't exist
-			if err := createFileCopy(rc, targetFilePath, f.Mode(), uid, gid); err != nil {
-				rc.Close()
-				return err
-			}
+	stream := bufio.NewReaderSize(input, FormatHeaderSize)
+	header, err := stream.Peek(FormatHeaderSize)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read archive: %v", err)
+	}
+	x, err := lookupExtractor(format, header)
+	if err != nil {
+		return err
+	}
+
+	a.Reader = &countingReader{r: stream, n: &t.archiveSize}
+	defer a.close()
+	return x.Extract(a, dst)
+}
+
+// archiveReader is the Archive that is passed to the extractors
+type archiveReader struct {
+	io.Reader
+	t *target
+	// the archive file (nil if the archive is read from the standard input)
+	file *os.File
+	// the temporary file to which a streamed archive has been buffered
+	spool *os.File
+}
+
+func (a *archiveReader) ReaderAt() (io.ReaderAt, int64, error) {
+	if a.file != nil {
+		info, err := a.file.Stat()
+		if err != nil {
+			return nil, 0, err
 		}
+		atomic.StoreInt64(&a.t.archiveSize, info.Size())
+		return a.file, info.Size(), nil
+	}
+	if a.spool != nil {
+		return a.spool, atomic.LoadInt64(&a.t.archiveSize), nil
+	}
+	// buffer the archive to a temporary file next to the target directory
+	// (or to the system's temporary directory if nothing is extracted)
+	dir := filepath.Dir(a.t.root)
+	if a.t.dryRun != nil {
+		dir = ""
+	}
+	spool, err := os.CreateTemp(dir, ".stdin-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to buffer archive: %v", err)
+	}
+	a.spool = spool
+	// the archive's size is counted while reading
+	size, err := io.Copy(spool, a.Reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to buffer archive: %v", err)
+	}
+	return spool, size, nil
+}
 
-		// close the file in the archive
-		rc.Close()
+func (a *archiveReader) close() {
+	if a.spool != nil {
+		a.spool.Close()
+		os.Remove(a.spool.Name())
 	}
+}
 
+// Add extracts the archive entry `e` to the target (see Target)
+func (t *target) Add(e Entry, r io.Reader) error {
+	if err := t.countEntry(e.Name, e.Size); err != nil {
+		return err
+	}
+	name, ok := t.entryName(e.Name)
+	if !ok || !t.included(name, e.Type == TypeDir) {
+		return nil
+	}
+	filePath, err := t.resolve(name)
+	if err != nil {
+		return err
+	}
+	if t.dryRun != nil {
+		return t.simulate(name, filePath, e, r)
+	}
+	if err := t.createParents(filePath); err != nil {
+		return fmt.Errorf("failed to create parent directories of %s: %v", filePath, err)
+	}
+	uid, gid := t.owner(e.Owner)
+
+	switch e.Type {
+	case TypeDir:
+		mode := t.permissions(name, e.Mode)
+		if err := createDirectory(filePath, mode, uid, gid); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", filePath, err)
+		}
+		if err := t.setMode(filePath, mode); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %v", filePath, err)
+		}
+		t.deferModTime(filePath, e.ModTime)
+	case TypeFile:
+		mode := t.permissions(name, e.Mode)
+		if err := createFileCopy(t.meter(name, r), filePath, mode, uid, gid); err != nil {
+			return entryError(err, "failed to create file %s", filePath)
+		}
+		if err := t.setMode(filePath, mode); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %v", filePath, err)
+		}
+		if err := t.setModTime(filePath, e.ModTime); err != nil {
+			return fmt.Errorf("failed to set modification time of %s: %v", filePath, err)
+		}
+	case TypeSymlink:
+		if err := t.createSymlink(name, e.Linkname, uid, gid); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %v", filePath, err)
+		}
+	case TypeHardLink:
+		linkname, err := t.hardLinkTarget(e.Linkname)
+		if err != nil {
+			return fmt.Errorf("failed to create hard link %s: %v", filePath, err)
+		}
+		if err := t.createHardLink(name, linkname); err != nil {
+			return fmt.Errorf("failed to create hard link %s: %v", filePath, err)
+		}
+	default:
+		return fmt.Errorf("unsupported file type: file=%s type=%d", e.Name, e.Type)
+	}
 	return nil
 }
 
-func decompressTarGzip(gzipFile, targetDir string, uid, gid int) error {
-	stream, err := os.Open(gzipFile)
+// create a symbolic link named `name` that points to `linkname` and is owned by `uid` and `gid`
+// the link must point to a location inside the target directory
+func (t *target) createSymlink(name, linkname string, uid, gid int) error {
+	filePath, err := t.resolve(name)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+		return err
+	}
+	if err := t.checkSymlink(name, linkname); err != nil {
+		return err
 	}
-	defer stream.Close()
-	uncompressedStream, err := gzip.NewReader(stream)
+	if err := t.createParents(filePath); err != nil {
+		return err
+	}
+	if err := removeExisting(filePath); err != nil {
+		return err
+	}
+	if err := os.Symlink(linkname, filePath); err != nil {
+		return err
+	}
+	t.symlinks = append(t.symlinks, [2]string{name, linkname})
+	return os.Lchown(filePath, uid, gid)
+}
+
+// create a hard link named `name` to the (already extracted) archive entry `linkname`
+// the new link shares the ownership of the existing entry
+// return the name of the entry that a hard link to `linkname` refers to;
+// hard links refer to other entries of the archive, so the latter must
+// also be extracted (i.e. it can not be stripped or filtered out)
+func (t *target) hardLinkTarget(linkname string) (string, error) {
+	name, ok := t.entryName(linkname)
+	if !ok {
+		return "", fmt.Errorf("target %s has been stripped", linkname)
+	}
+	if !t.included(name, false) {
+		return "", fmt.Errorf("target %s has been filtered out by --include/--exclude", linkname)
+	}
+	return name, nil
+}
+
+func (t *target) createHardLink(name, linkname string) error {
+	filePath, err := t.resolve(name)
 	if err != nil {
-		return fmt.Errorf("failed to read archive: %v", err)
+		return err
 	}
+	existingPath, err := t.resolve(linkname)
+	if err != nil {
+		return err
+	}
+	if err := t.createParents(filePath); err != nil {
+		return err
+	}
+	if err := removeExisting(filePath); err != nil {
+		return err
+	}
+	return os.Link(existingPath, filePath)
+}
 
-	tarReader := tar.NewReader(uncompressedStream)
+// make sure that the symbolic link `name` -> `linkname` resolves
+// to a location inside the target directory
+func (t *target) checkSymlink(name, linkname string) error {
+	if path.IsAbs(linkname) || filepath.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return fmt.Errorf("unsafe entry %q: link to absolute path %s is not allowed", name, linkname)
+	}
+	// the link's target is relative to the link's parent directory
+	components := splitPath(name)
+	if len(components) > 0 {
+		components = components[:len(components)-1]
+	}
+	components = append(components, splitPath(linkname)...)
+	if _, err := t.walk(components, true); err != nil {
+		return fmt.Errorf("unsafe entry %q: link to %s: %v", name, linkname, err)
+	}
+	return nil
+}
 
-	for true {
-		header, err := tarReader.Next()
+// complete the extraction of an archive into the target
+func (t *target) finish() error {
+	if err := t.verifySymlinks(); err != nil {
+		return err
+	}
+	return t.restoreDirModTimes()
+}
 
-		if err == io.EOF {
-			break
+// check again all the symbolic links created during the extraction since
+// links extracted later may have changed the meaning of earlier links
+func (t *target) verifySymlinks() error {
+	for _, link := range t.symlinks {
+		if err := t.checkSymlink(link[0], link[1]); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if err != nil {
-			return fmt.Errorf("failed to extract file from archive: %v", err)
+// remove the non-directory file at `p` (if any) so that it can be replaced
+// (like tar(1) does) instead of having its contents or target overwritten
+func removeExisting(p string) error {
+	info, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is an existing directory", p)
+	}
+	return os.Remove(p)
+}
+
+// return the name of the archive entry `name` after removing the requested
+// number of leading path components and the requested sub-path; the function
+// returns false if the entry should be skipped because it has no components
+// left or because it is not under the sub-path
+func (t *target) entryName(name string) (string, bool) {
+	if t.opts.StripComponents <= 0 && t.opts.SubPath == "" {
+		return name, true
+	}
+	components := splitPath(name)
+	if strip := t.opts.StripComponents; strip > 0 {
+		// like GNU tar, count the leading "." of entries such as "./top/a.txt"
+		// (i.e. of archives created with `tar -C dir .`) as a component
+		if n := filepath.ToSlash(name); n == "." || strings.HasPrefix(n, "./") {
+			strip--
 		}
+		if len(components) <= strip {
+			return "", false
+		}
+		components = components[strip:]
+	}
+	if t.opts.SubPath != "" {
+		prefix := splitPath(t.opts.SubPath)
+		if len(components) <= len(prefix) {
+			return "", false
+		}
+		for idx, c := range prefix {
+			if components[idx] != c {
+				return "", false
+			}
+		}
+		components = components[len(prefix):]
+	}
+	return path.Join(components...), true
+}
 
-		filePath := path.Join(targetDir, header.Name)
+// if the target contains a single directory, then replace the target's
+// contents with the contents of that directory and return its name
+func (t *target) unwrap() (string, error) {
+	entries, err := os.ReadDir(t.root)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return "", nil
+	}
+	top := entries[0].Name()
+	unwrapped := t.root + ".unwrap"
+	if err := os.Rename(filepath.Join(t.root, top), unwrapped); err != nil {
+		return "", err
+	}
+	if err := os.Remove(t.root); err != nil {
+		return "", err
+	}
+	if err := os.Rename(unwrapped, t.root); err != nil {
+		return "", err
+	}
+	// all the links have moved one level up
+	for idx, link := range t.symlinks {
+		t.symlinks[idx][0] = path.Join(splitPath(link[0])[1:]...)
+	}
+	return top, t.verifySymlinks()
+}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := createDirectory(filePath, os.FileMode(header.Mode), uid, gid); err != nil {
-				return fmt.Errorf("failed to create directory %s: %v", filePath, err)
-			}
-		case tar.TypeReg:
-			if err := createFileCopy(tarReader, filePath, os.FileMode(header.Mode), uid, gid); err != nil {
-				return fmt.Errorf("failed to create file %s: %v", filePath, err)
-			}
+// return the location in the target directory to which the archive entry
+// `name` should be extracted; symbolic links that have already been
+// extracted are followed for all but the last path component and the
+// function fails if the location is not inside the target directory
+func (t *target) resolve(name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("unsafe entry %q: absolute paths are not allowed", name)
+	}
+	components, err := t.walk(splitPath(name), false)
+	if err != nil {
+		return "", fmt.Errorf("unsafe entry %q: %v", name, err)
+	}
+	return filepath.Join(t.root, filepath.Join(components...)), nil
+}
 
-		default:
-			return fmt.Errorf("unsupported file type: file=%s type=%d", header.Name, header.Typeflag)
+// walk the path `components` starting from the target directory and
+// return the components of the resolved path relative to the target
+// directory; the function fails as soon as the walk leaves the
+// target directory, either through ".." or through a symbolic link
+// The last component is followed only if `followLast` is true
+func (t *target) walk(components []string, followLast bool) ([]string, error) {
+	var (
+		resolved = []string{}
+		hops     = 0
+	)
+	for len(components) > 0 {
+		c := components[0]
+		components = components[1:]
+		if c == ".." {
+			if len(resolved) == 0 {
+				return nil, errors.New("path escapes the release directory")
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		resolved = append(resolved, c)
+		// the last component is the entry itself (not one of its parents)
+		if len(components) == 0 && !followLast {
+			break
+		}
+		link, err := t.readlink(resolved)
+		if err != nil {
+			return nil, err
+		}
+		if link == "" {
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return nil, errors.New("too many levels of symbolic links")
 		}
+		if path.IsAbs(link) || filepath.IsAbs(link) {
+			return nil, fmt.Errorf("symbolic link %s points to an absolute path", path.Join(resolved...))
+		}
+		// replace the link with its target (which is relative to the link's parent)
+		resolved = resolved[:len(resolved)-1]
+		components = append(splitPath(link), components...)
+	}
+	return resolved, nil
+}
 
+// return the target of the symbolic link at the given location
+// in the target directory (or "" if the location is not a symbolic link)
+func (t *target) readlink(components []string) (string, error) {
+	if t.dryRun != nil {
+		return t.dryRun.readlink(components), nil
+	}
+	p := filepath.Join(t.root, filepath.Join(components...))
+	info, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", nil
 	}
+	link, err := os.Readlink(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(link), nil
+}
 
-	return nil
+// split an archive path to its non-empty components
+func splitPath(name string) []string {
+	components := []string{}
+	for _, c := range strings.Split(filepath.ToSlash(name), "/") {
+		if c != "" && c != "." {
+			components = append(components, c)
+		}
+	}
+	return components
 }
 
 // 1. create the `target` file
 // 2. copy the contents of `src` to `target`
 // 3. set the uid and gid of the target file
 func createFileCopy(src io.Reader, target string, mode os.FileMode, uid, gid int) error {
+	// do not write through an existing link
+	if err := removeExisting(target); err != nil {
+		return err
+	}
 	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
@@ -123,12 +502,47 @@ func createFileCopy(src io.Reader, target string, mode os.FileMode, uid, gid int
 	if _, err := io.Copy(f, src); err != nil {
 		return err
 	}
-	return nil
+	return f.Sync()
 }
 
+// create the directory `path` with `mode` or, if the directory already exists
+// (e.g. it was created as the parent of a preceding entry), update its mode
+// since mkdir(2) leaves the mode of existing directories untouched
 func createDirectory(path string, mode os.FileMode, uid, gid int) error {
-	if err := os.MkdirAll(path, mode); err != nil {
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(path, mode); err != nil {
 		return err
 	}
 	return os.Chown(path, uid, gid)
 }
+
+// create the missing parent directories of `filePath` (a resolved location
+// in the target directory), since archives may omit directory entries
+// The directories are owned by the target's uid/gid
+func (t *target) createParents(filePath string) error {
+	rel, err := filepath.Rel(t.root, filepath.Dir(filePath))
+	if err != nil {
+		return err
+	}
+	mode := t.permissions("", implicitDirMode)
+	dir := t.root
+	for _, c := range splitPath(rel) {
+		dir = filepath.Join(dir, c)
+		// files may be extracted concurrently into the same directory
+		if err := os.Mkdir(dir, mode); os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := os.Chown(dir, t.uid, t.gid); err != nil {
+			return err
+		}
+		if err := t.setMode(dir, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
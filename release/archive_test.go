@@ -1,9 +1,11 @@
 package release
 
 import (
+	"archive/tar"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/uuid"
@@ -12,34 +14,381 @@ import (
 )
 
 func Test_Tarball_Decompression(t *testing.T) {
-	uid, gid, err := resolveUser("")
-	require.NoError(t, err)
-
 	target := uuid.NewString()
 	defer os.RemoveAll(target)
 
-	require.NoError(t, decompressArchive("test/foo.tar.gz", target, uid, gid))
+	require.NoError(t, decompressArchive("test/foo.tar.gz", "", nil, testTarget(t, target)))
 	assert.FileExists(t, path.Join(target, "foo/bar.txt"))
 }
 
-func Test_Zip_Decompression(t *testing.T) {
-	uid, gid, err := resolveUser("")
-	require.NoError(t, err)
+func Test_Tar_Decompression_AllCompressionFormats(t *testing.T) {
+	for _, archive := range []string{
+		"test/foo.tar",
+		"test/foo.tgz",
+		"test/foo.tar.xz",
+		"test/foo.tar.bz2",
+		"test/foo.tar.zst",
+	} {
+		target := uuid.NewString()
+		require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)), archive)
+		assert.FileExists(t, path.Join(target, "foo/bar.txt"), archive)
+		os.RemoveAll(target)
+	}
+}
 
+func Test_Zip_Decompression(t *testing.T) {
 	target := uuid.NewString()
 	defer os.RemoveAll(target)
 
-	require.NoError(t, decompressArchive("test/foo.zip", target, uid, gid))
+	require.NoError(t, decompressArchive("test/foo.zip", "", nil, testTarget(t, target)))
 	assert.FileExists(t, path.Join(target, "foo/bar.txt"))
 }
 
 func Test_UnsupportedArchive(t *testing.T) {
-	uid, gid, err := resolveUser("")
-	require.NoError(t, err)
-
 	source := fmt.Sprintf("%s.txt", uuid.NewString())
 	require.NoError(t, os.WriteFile(source, []byte("hello"), 0777))
 	defer os.Remove(source)
 
-	assert.ErrorContains(t, decompressArchive(source, "", uid, gid), "unsupported")
+	assert.ErrorContains(t, decompressArchive(source, "", nil, testTarget(t, "")), "unsupported")
+}
+
+func Test_Decompression_ShouldRejectEntriesOutsideTarget(t *testing.T) {
+	parent := uuid.NewString()
+	require.NoError(t, os.Mkdir(parent, 0755))
+	defer os.RemoveAll(parent)
+	target := path.Join(parent, "release")
+
+	for _, name := range []string{"../evil.txt", "foo/../../evil.txt", "/tmp/evil.txt"} {
+		for _, archive := range []string{
+			createTarGz(t, []testEntry{{name: name, body: "evil"}}),
+			createZip(t, []testEntry{{name: name, body: "evil"}}),
+		} {
+			require.NoError(t, os.MkdirAll(target, 0755))
+			err := decompressArchive(archive, "", nil, testTarget(t, target))
+			assert.ErrorContains(t, err, fmt.Sprintf("unsafe entry %q", name), archive)
+			assert.NoFileExists(t, path.Join(parent, "evil.txt"))
+			require.NoError(t, os.RemoveAll(target))
+		}
+	}
+}
+
+func Test_Decompression_ShouldRejectEntriesThroughSymlinksOutsideTarget(t *testing.T) {
+	parent, err := filepath.Abs(uuid.NewString())
+	require.NoError(t, err)
+	target := path.Join(parent, "release")
+	require.NoError(t, os.MkdirAll(target, 0755))
+	defer os.RemoveAll(parent)
+	// links that have been extracted before the entry
+	require.NoError(t, os.Symlink("..", path.Join(target, "up")))
+	require.NoError(t, os.Symlink(parent, path.Join(target, "abs")))
+	require.NoError(t, os.Symlink(".", path.Join(target, "self")))
+
+	for _, name := range []string{"up/evil.txt", "abs/evil.txt", "self/up/evil.txt"} {
+		archive := createTarGz(t, []testEntry{{name: name, body: "evil"}})
+		err := decompressArchive(archive, "", nil, testTarget(t, target))
+		assert.ErrorContains(t, err, fmt.Sprintf("unsafe entry %q", name))
+		assert.NoFileExists(t, path.Join(parent, "evil.txt"))
+	}
+
+	// links that stay inside the target are fine
+	archive := createTarGz(t, []testEntry{{name: "self/good.txt", body: "good"}})
+	require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+	assert.FileExists(t, path.Join(target, "good.txt"))
+}
+
+func Test_Tarball_Decompression_ShouldCreateLinks(t *testing.T) {
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+
+	archive := createTarGz(t, []testEntry{
+		{name: "foo/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "foo/bar.txt", body: "bar"},
+		{name: "foo/link", typeflag: tar.TypeSymlink, linkname: "bar.txt"},
+		{name: "foo/hard", typeflag: tar.TypeLink, linkname: "foo/bar.txt"},
+		{name: "bin", typeflag: tar.TypeSymlink, linkname: "foo"},
+		// written through a link that stays inside the target
+		{name: "bin/baz.txt", body: "baz"},
+	})
+	require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+
+	link, err := os.Readlink(path.Join(target, "foo/link"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar.txt", link)
+	contents, err := os.ReadFile(path.Join(target, "foo/link"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(contents))
+
+	original, err := os.Stat(path.Join(target, "foo/bar.txt"))
+	require.NoError(t, err)
+	hard, err := os.Lstat(path.Join(target, "foo/hard"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(original, hard))
+
+	assert.FileExists(t, path.Join(target, "foo/baz.txt"))
+}
+
+func Test_Tarball_Decompression_ShouldRejectLinksOutsideTarget(t *testing.T) {
+	for _, entries := range [][]testEntry{
+		{{name: "evil", typeflag: tar.TypeSymlink, linkname: "../../etc"}},
+		{{name: "foo/evil", typeflag: tar.TypeSymlink, linkname: "../.."}},
+		{{name: "evil", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}},
+		{{name: "evil", typeflag: tar.TypeLink, linkname: "../outside.txt"}},
+		// a link that escapes through another link
+		{
+			{name: "a/b/p", typeflag: tar.TypeSymlink, linkname: "../../c"},
+			{name: "a/b/evil", typeflag: tar.TypeSymlink, linkname: "p/../.."},
+		},
+		// ... even when the other link is extracted later
+		{
+			{name: "a/b/evil", typeflag: tar.TypeSymlink, linkname: "p/../.."},
+			{name: "a/b/p", typeflag: tar.TypeSymlink, linkname: "../../c"},
+		},
+	} {
+		target := uuid.NewString()
+		require.NoError(t, os.MkdirAll(path.Join(target, "a/b"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(target, "foo"), 0755))
+
+		archive := createTarGz(t, entries)
+		err := decompressArchive(archive, "", nil, testTarget(t, target))
+		assert.ErrorContains(t, err, "unsafe entry", entries)
+		assert.ErrorContains(t, err, "evil", entries)
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Zip_Decompression_ShouldCreateSymlinks(t *testing.T) {
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+
+	archive := createZip(t, []testEntry{
+		{name: "foo/", mode: os.ModeDir | 0755},
+		{name: "foo/bar.txt", body: "bar"},
+		{name: "foo/link", mode: os.ModeSymlink | 0777, linkname: "bar.txt"},
+	})
+	require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+
+	info, err := os.Lstat(path.Join(target, "foo/link"))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+	contents, err := os.ReadFile(path.Join(target, "foo/link"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(contents))
+}
+
+func Test_Zip_Decompression_ShouldRejectSymlinksOutsideTarget(t *testing.T) {
+	for _, linkname := range []string{"../../etc", "/etc/passwd"} {
+		target := uuid.NewString()
+		archive := createZip(t, []testEntry{
+			{name: "evil", mode: os.ModeSymlink | 0777, linkname: linkname},
+		})
+		assert.ErrorContains(t, decompressArchive(archive, "", nil, testTarget(t, target)), `unsafe entry "evil"`)
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Decompression_ShouldCreateMissingParentDirectories(t *testing.T) {
+	entries := []testEntry{
+		{name: "path/to/file.txt", body: "foo"},
+		{name: "path/to/other/file.txt", body: "bar"},
+		{name: "links/to/file", typeflag: tar.TypeSymlink, mode: os.ModeSymlink, linkname: "../../path/to/file.txt"},
+	}
+	for _, archive := range []string{createTarGz(t, entries), createZip(t, entries)} {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		umask := os.FileMode(0)
+		tt := testTarget(t, target)
+		tt.opts.Umask = &umask
+		require.NoError(t, decompressArchive(archive, "", nil, tt), archive)
+
+		for _, dir := range []string{"path", "path/to", "path/to/other", "links/to"} {
+			info, err := os.Stat(path.Join(target, dir))
+			require.NoError(t, err)
+			assert.Equal(t, os.ModeDir|0755, info.Mode(), dir)
+		}
+		contents, err := os.ReadFile(path.Join(target, "links/to/file"))
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(contents))
+
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Tarball_Decompression_ShouldApplyModeOfDirectoriesAfterTheirContents(t *testing.T) {
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+
+	// the directory's entry follows the file that it contains
+	archive := createTarGz(t, []testEntry{
+		{name: "a/x.txt", body: "foo", mode: 0644},
+		{name: "a/", typeflag: tar.TypeDir, mode: os.ModeDir | 0700},
+	})
+	require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+
+	info, err := os.Stat(path.Join(target, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0700, info.Mode())
+	assert.Equal(t, "foo", readFile(t, path.Join(target, "a/x.txt")))
+}
+
+func Test_Tarball_Decompression_ShouldCreateParentsOfHardLinks(t *testing.T) {
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+
+	archive := createTarGz(t, []testEntry{
+		{name: "bin/tool", body: "tool"},
+		{name: "usr/bin/tool", typeflag: tar.TypeLink, linkname: "bin/tool"},
+	})
+	require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+
+	original, err := os.Stat(path.Join(target, "bin/tool"))
+	require.NoError(t, err)
+	hard, err := os.Stat(path.Join(target, "usr/bin/tool"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(original, hard))
+}
+
+func Test_Decompression_ShouldDetectFormatFromContents(t *testing.T) {
+	for _, fixture := range []string{
+		"test/foo.zip",
+		"test/foo.tar",
+		"test/foo.tar.gz",
+		"test/foo.tar.xz",
+		"test/foo.tar.bz2",
+		"test/foo.tar.zst",
+	} {
+		// store the archive under a name without a (meaningful) suffix
+		contents, err := os.ReadFile(fixture)
+		require.NoError(t, err)
+		archive := "artifact-" + uuid.NewString()
+		require.NoError(t, os.WriteFile(archive, contents, 0644))
+		target := uuid.NewString()
+
+		require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)), fixture)
+		assert.FileExists(t, path.Join(target, "foo/bar.txt"), fixture)
+
+		os.Remove(archive)
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Decompression_WithExplicitFormat(t *testing.T) {
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+
+	require.NoError(t, decompressArchive("test/foo.tar.gz", "tgz", nil, testTarget(t, target)))
+	assert.FileExists(t, path.Join(target, "foo/bar.txt"))
+
+	assert.Error(t, decompressArchive("test/foo.tar.gz", "zip", nil, testTarget(t, target)))
+	assert.ErrorContains(t, decompressArchive("test/foo.tar.gz", "rar", nil, testTarget(t, target)), "unknown archive format rar")
+}
+
+func Test_Decompression_FromStdin(t *testing.T) {
+	for _, fixture := range []string{"test/foo.tar.gz", "test/foo.tar.zst", "test/foo.zip"} {
+		stdin, err := os.Open(fixture)
+		require.NoError(t, err)
+		// the target's parent is used for buffering zip archives
+		parent := uuid.NewString()
+		target := path.Join(parent, "release")
+		require.NoError(t, os.MkdirAll(target, 0755))
+
+		require.NoError(t, decompressArchive(StdinPath, "", stdin, testTarget(t, target)), fixture)
+		assert.FileExists(t, path.Join(target, "foo/bar.txt"), fixture)
+		// no temporary files are left behind
+		entries, err := os.ReadDir(parent)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, fixture)
+
+		stdin.Close()
+		os.RemoveAll(parent)
+	}
+}
+
+func Test_Decompression_WithStripComponents(t *testing.T) {
+	entries := []testEntry{
+		{name: "myapp-1.2.3/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "myapp-1.2.3/bin/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "myapp-1.2.3/bin/myapp", body: "binary", mode: 0755},
+		{name: "myapp-1.2.3/README", body: "readme"},
+		{name: "myapp-1.2.3/bin/app", typeflag: tar.TypeLink, linkname: "myapp-1.2.3/bin/myapp"},
+	}
+	for _, archive := range []string{createTarGz(t, entries), createZip(t, entries[:4])} {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		tt := testTarget(t, target)
+		tt.opts.StripComponents = 1
+
+		require.NoError(t, decompressArchive(archive, "", nil, tt), archive)
+		assert.FileExists(t, path.Join(target, "bin/myapp"))
+		assert.FileExists(t, path.Join(target, "README"))
+		assert.NoDirExists(t, path.Join(target, "myapp-1.2.3"))
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Decompression_WithStripComponents_ShouldCountLeadingDot(t *testing.T) {
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+
+	// e.g. created with `tar -C dist -czf bundle.tar.gz .`
+	archive := createTarGz(t, []testEntry{
+		{name: "./", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "./top/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "./top/a.txt", body: "a"},
+	})
+	tt := testTarget(t, target)
+	tt.opts.StripComponents = 1
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+	assert.Equal(t, "a", readFile(t, path.Join(target, "top/a.txt")))
+
+	name, ok := tt.entryName("./top/a.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "top/a.txt", name)
+	_, ok = tt.entryName("./")
+	assert.False(t, ok)
+}
+
+func Test_Unwrap(t *testing.T) {
+	parent := uuid.NewString()
+	defer os.RemoveAll(parent)
+	target := path.Join(parent, "release")
+	require.NoError(t, os.MkdirAll(target, 0755))
+
+	archive := createTarGz(t, []testEntry{
+		{name: "myapp-1.2.3/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "myapp-1.2.3/README", body: "readme"},
+		{name: "myapp-1.2.3/link", typeflag: tar.TypeSymlink, linkname: "README"},
+	})
+	tt := testTarget(t, target)
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+	top, err := tt.unwrap()
+	require.NoError(t, err)
+	assert.Equal(t, "myapp-1.2.3", top)
+	assert.FileExists(t, path.Join(target, "README"))
+	assert.FileExists(t, path.Join(target, "link"))
+	// nothing to unwrap anymore
+	top, err = tt.unwrap()
+	require.NoError(t, err)
+	assert.Empty(t, top)
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func Test_Unwrap_ShouldRejectLinksThatEscapeAfterUnwrapping(t *testing.T) {
+	parent := uuid.NewString()
+	defer os.RemoveAll(parent)
+	target := path.Join(parent, "release")
+	require.NoError(t, os.MkdirAll(target, 0755))
+
+	archive := createTarGz(t, []testEntry{
+		{name: "myapp/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "myapp/link", typeflag: tar.TypeSymlink, linkname: "../myapp"},
+	})
+	tt := testTarget(t, target)
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+	_, err := tt.unwrap()
+	assert.ErrorContains(t, err, `unsafe entry "link"`)
 }
@@ -0,0 +1,122 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// a dry-run target records the symbolic links of the archive in memory
+// (instead of creating them) so that the archive's paths can be validated
+// without creating anything on disk
+type dryRun struct {
+	mu sync.RWMutex
+	// the target (name) of each symbolic link by its resolved location
+	links map[string]string
+}
+
+// create a target that validates the entries added to it without extracting them
+func newDryRunTarget(opts ExtractOptions) *target {
+	t := newTarget("", -1, -1, opts)
+	t.dryRun = &dryRun{links: map[string]string{}}
+	return t
+}
+
+// Check validates the source's contents without extracting them, i.e. it
+// verifies that an archive is readable, that it respects the limits of
+// `opts` and that it contains no entries that would end up outside of the
+// release directory; it then prints a summary of the contents to `stdout`
+func Check(src Source, opts ExtractOptions, stdout io.Writer) error {
+	if u, ok := src.(*urlSource); ok {
+		defer u.remove()
+	}
+	_, err := check(src, opts, stdout)
+	return err
+}
+
+// check the source and return the dry-run target, i.e. the source's totals
+func check(src Source, opts ExtractOptions, stdout io.Writer) (*target, error) {
+	if err := validatePatterns(append(opts.Include, opts.Exclude...)); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(stdout, "[check] checking %s\n", src)
+	t := newDryRunTarget(opts)
+	p := startCheckProgress(stdout, t)
+	err := src.check(t)
+	p.stop()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(stdout, "[check] entries=%d size=%d\n", t.entries, t.written)
+	return t, nil
+}
+
+// validate the entry `name` (see Add) that resolves to `filePath`
+func (t *target) simulate(name, filePath string, e Entry, r io.Reader) error {
+	switch e.Type {
+	case TypeDir:
+		// an existing link is not replaced by a directory (see createDirectory)
+	case TypeFile:
+		t.dryRun.forget(filePath)
+		if _, ok := r.(*zipContents); ok {
+			// the sizes of the files of zip archives are declared in the
+			// archive's central directory, so the limits are verified without
+			// decompressing the contents (the actual sizes are enforced while
+			// extracting the archive)
+			if err := t.countBytes(name, e.Size, e.Size); err != nil {
+				return entryError(err, "invalid file %s", name)
+			}
+			return nil
+		}
+		// the contents are read so that the archive's integrity and limits are verified
+		if _, err := io.Copy(io.Discard, t.meter(name, r)); err != nil {
+			return entryError(err, "failed to read file %s", name)
+		}
+	case TypeSymlink:
+		if err := t.checkSymlink(name, e.Linkname); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %v", filePath, err)
+		}
+		t.dryRun.mu.Lock()
+		t.dryRun.links[filePath] = e.Linkname
+		t.dryRun.mu.Unlock()
+		t.symlinks = append(t.symlinks, [2]string{name, e.Linkname})
+	case TypeHardLink:
+		linkname, err := t.hardLinkTarget(e.Linkname)
+		if err != nil {
+			return fmt.Errorf("failed to create hard link %s: %v", filePath, err)
+		}
+		if _, err := t.resolve(linkname); err != nil {
+			return fmt.Errorf("failed to create hard link %s: %v", filePath, err)
+		}
+		t.dryRun.forget(filePath)
+	default:
+		return fmt.Errorf("unsupported file type: file=%s type=%d", e.Name, e.Type)
+	}
+	return nil
+}
+
+// an entry that replaces a symbolic link
+func (d *dryRun) forget(p string) {
+	d.mu.Lock()
+	delete(d.links, p)
+	d.mu.Unlock()
+}
+
+// return the target of the symbolic link at the given location (see readlink)
+func (d *dryRun) readlink(components []string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.links[filepath.Join(components...)]
+}
+
+// forget the links whose locations are removed (see whiteout)
+func (d *dryRun) forgetAll(removed func(p string) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for p := range d.links {
+		if removed(p) {
+			delete(d.links, p)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package release
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Check_ShouldSummarizeValidArchives(t *testing.T) {
+	for _, fixture := range []string{"test/foo.zip", "test/foo.tar.gz", "test/foo.tar.zst"} {
+		var out bytes.Buffer
+		require.NoError(t, Check(NewArchiveSource(fixture, "", nil), ExtractOptions{Limits: DefaultLimits}, &out), fixture)
+		assert.Contains(t, out.String(), "[check] checking bundle="+fixture+"\n")
+		assert.Regexp(t, `\[check\] entries=\d+ size=\d+\n`, out.String())
+	}
+}
+
+func Test_Check_ShouldRejectInvalidArchives(t *testing.T) {
+	contents, err := os.ReadFile("test/foo.tar.gz")
+	require.NoError(t, err)
+	truncated := uuid.NewString()
+	require.NoError(t, os.WriteFile(truncated, contents[:len(contents)/2], 0644))
+	defer os.Remove(truncated)
+
+	tests := []struct {
+		archive string
+		opts    ExtractOptions
+		err     string
+	}{
+		{truncated, ExtractOptions{}, "unexpected EOF"},
+		{"test/foo.zip", ExtractOptions{Limits: Limits{MaxFiles: 1}}, "archive exceeds the maximum number of entries (1)"},
+		{createTarGz(t, []testEntry{{name: "../escape.txt", body: "foo"}}), ExtractOptions{}, `unsafe entry "../escape.txt"`},
+		{createTarGz(t, []testEntry{
+			{name: "sub/", typeflag: tar.TypeDir, mode: 0755},
+			// the link exists only in the checker's memory
+			{name: "sub/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "sub/up/../escape.txt", body: "foo"},
+		}), ExtractOptions{}, `unsafe entry "sub/up/../escape.txt"`},
+		{createZip(t, []testEntry{{name: "link", mode: os.ModeSymlink, linkname: "../outside"}}), ExtractOptions{}, `unsafe entry "link"`},
+	}
+	for _, test := range tests {
+		err := Check(NewArchiveSource(test.archive, "", nil), test.opts, io.Discard)
+		assert.ErrorContains(t, err, test.err, test.archive)
+	}
+}
+
+func Test_Check_ShouldAllowReplacedLinks(t *testing.T) {
+	archive := createTarGz(t, []testEntry{
+		{name: "sub/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "sub/up", typeflag: tar.TypeSymlink, linkname: ".."},
+		// the link is replaced by a file so the path stays inside the release
+		{name: "sub/up", body: "up"},
+		{name: "sub/up/../file.txt", body: "foo"},
+	})
+	assert.NoError(t, Check(NewArchiveSource(archive, "", nil), ExtractOptions{}, io.Discard))
+}
+
+func Test_Install_ShouldNotTouchWorkspace_WhenArchiveIsInvalid(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	archive := createTarGz(t, []testEntry{{name: "foo.txt", body: "foo"}, {name: "../escape.txt", body: "foo"}})
+	_, err := Install(workspace, NewArchiveSource(archive, "", nil), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+	assert.ErrorContains(t, err, `invalid archive: unsafe entry "../escape.txt"`)
+	assert.NoDirExists(t, workspace)
+}
+
+func Test_Check_ShouldNotDecompressZipContents(t *testing.T) {
+	archive := createZip(t, []testEntry{{name: "foo.txt", body: strings.Repeat("foo", 1000)}})
+	// corrupt the file's compressed contents (but not the archive's directory)
+	r, err := zip.OpenReader(archive)
+	require.NoError(t, err)
+	offset, err := r.File[0].DataOffset()
+	require.NoError(t, err)
+	r.Close()
+	f, err := os.OpenFile(archive, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(bytes.Repeat([]byte{0xff}, 8), offset)
+	require.NoError(t, err)
+	f.Close()
+
+	// the check relies on the declared sizes
+	var out bytes.Buffer
+	require.NoError(t, Check(NewArchiveSource(archive, "", nil), ExtractOptions{}, &out))
+	assert.Contains(t, out.String(), "[check] entries=1 size=3000\n")
+	err = Check(NewArchiveSource(archive, "", nil), ExtractOptions{Limits: Limits{MaxTotalSize: 2000}}, io.Discard)
+	assert.ErrorContains(t, err, "archive exceeds the maximum extracted size (2000 bytes)")
+
+	// whereas the contents are verified while being extracted
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	assert.Error(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+}
@@ -0,0 +1,145 @@
+package release
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// ================
+// HELPER FUNCTIONS
+// ================
+
+// an entry to be written to a test archive
+type testEntry struct {
+	name     string
+	body     string
+	mode     os.FileMode
+	linkname string
+	modTime  time.Time
+	// only used in tar archives
+	typeflag     byte
+	uid, gid     int
+	uname, gname string
+}
+
+// create a tar.gz archive with the given entries and return its path
+// the archive is removed when the test ends
+func createTarGz(t *testing.T, entries []testEntry) string {
+	archivePath := uuid.NewString() + ".tar.gz"
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(archivePath) })
+
+	gw := gzip.NewWriter(f)
+	writeTar(t, gw, entries)
+	require.NoError(t, gw.Close())
+	require.NoError(t, f.Close())
+	return archivePath
+}
+
+// create an (uncompressed) tar archive with the given entries and return its path
+// the archive is removed when the test ends
+func createTar(t *testing.T, entries []testEntry) string {
+	archivePath := uuid.NewString() + ".tar"
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(archivePath) })
+
+	writeTar(t, f, entries)
+	require.NoError(t, f.Close())
+	return archivePath
+}
+
+// write a tar archive with the given entries to `w`
+func writeTar(t *testing.T, w io.Writer, entries []testEntry) {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Mode:     tarMode(e.mode),
+			Size:     int64(len(e.body)),
+			Linkname: e.linkname,
+			Typeflag: e.typeflag,
+			ModTime:  e.modTime,
+			Uid:      e.uid,
+			Gid:      e.gid,
+			Uname:    e.uname,
+			Gname:    e.gname,
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Size > 0 {
+			_, err := tw.Write([]byte(e.body))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+}
+
+// convert `mode` to the mode bits of a tar header
+func tarMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// create a zip archive with the given entries and return its path
+// the archive is removed when the test ends
+func createZip(t *testing.T, entries []testEntry) string {
+	archivePath := uuid.NewString() + ".zip"
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(archivePath) })
+
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modTime}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr.SetMode(mode)
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		body := e.body
+		if mode&os.ModeSymlink != 0 {
+			body = e.linkname
+		}
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+	return archivePath
+}
+
+// a target directory for extracting archives as the current user
+func testTarget(t *testing.T, dir string) *target {
+	uid, gid, err := resolveUser("")
+	require.NoError(t, err)
+	return newTarget(dir, uid, gid, ExtractOptions{Limits: DefaultLimits})
+}
@@ -0,0 +1,71 @@
+package release
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+// debExtractor extracts the payload (data.tar.*) of debian packages,
+// which are ar archives that contain the package's metadata and payload
+// as (compressed) tar archives
+type debExtractor struct{}
+
+func (debExtractor) Detect(header []byte) bool {
+	// the first member of a package is always debian-binary
+	return bytes.HasPrefix(header, []byte(arMagic+"debian-binary"))
+}
+
+func (debExtractor) Extract(archive Archive, t Target) error {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(archive, magic); err != nil || string(magic) != arMagic {
+		return errors.New("not an ar archive")
+	}
+	header := make([]byte, arHeaderSize)
+	for {
+		if _, err := io.ReadFull(archive, header); err == io.EOF {
+			return errors.New("data.tar member not found in package")
+		} else if err != nil {
+			return fmt.Errorf("failed to read package: %v", err)
+		}
+		if string(header[58:60]) != "`\n" {
+			return errors.New("failed to read package: invalid ar header")
+		}
+		// GNU ar terminates names with a slash
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("failed to read package: invalid size of member %s", name)
+		}
+		member := io.LimitReader(archive, size)
+		if strings.HasPrefix(name, "data.tar") {
+			// the payload's compression is denoted by its suffix
+			x, err := lookupExtractor(strings.TrimPrefix(name, "data."), nil)
+			if err != nil {
+				return fmt.Errorf("unsupported package payload %s", name)
+			}
+			return x.Extract(&streamedArchive{member}, t)
+		}
+		// members are aligned to an even offset
+		if _, err := io.CopyN(io.Discard, archive, size+size%2); err != nil {
+			return fmt.Errorf("failed to read package: %v", err)
+		}
+	}
+}
+
+// an archive that is nested inside another archive and can only be streamed
+type streamedArchive struct {
+	io.Reader
+}
+
+func (a *streamedArchive) ReaderAt() (io.ReaderAt, int64, error) {
+	return nil, 0, errors.New("nested archive does not support random access")
+}
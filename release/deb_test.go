@@ -0,0 +1,99 @@
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// create a debian package with the given members and return its path
+// the package is removed when the test ends
+func createDeb(t *testing.T, members ...[2]string) string {
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, m := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m[0]+"/", 0, 0, 0, "100644", len(m[1]))
+		buf.WriteString(m[1])
+		if len(m[1])%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	debPath := uuid.NewString() + ".deb"
+	require.NoError(t, os.WriteFile(debPath, buf.Bytes(), 0644))
+	t.Cleanup(func() { os.Remove(debPath) })
+	return debPath
+}
+
+// return the contents of the file at `p`
+func readFile(t *testing.T, p string) string {
+	contents, err := os.ReadFile(p)
+	require.NoError(t, err)
+	return string(contents)
+}
+
+// the contents of a package's payload
+func debPayload() []testEntry {
+	return []testEntry{
+		{name: "./", typeflag: tar.TypeDir, mode: 0755},
+		{name: "./opt/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "./opt/vendor/app/bin/app", body: "app", mode: 0755},
+		{name: "./opt/vendor/app/lib/libapp.so", body: "lib"},
+		{name: "./opt/vendor/app/current", typeflag: tar.TypeSymlink, linkname: "bin"},
+		{name: "./usr/share/doc/app/copyright", body: "copyright"},
+	}
+}
+
+func Test_Deb_Decompression(t *testing.T) {
+	payload := readFile(t, createTarGz(t, debPayload()))
+	deb := createDeb(t, [2]string{"debian-binary", "2.0\n"}, [2]string{"control.tar.gz", "control"}, [2]string{"data.tar.gz", payload})
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	require.NoError(t, decompressArchive(deb, "", nil, testTarget(t, target)))
+
+	assert.Equal(t, "app", readFile(t, path.Join(target, "opt/vendor/app/bin/app")))
+	assert.Equal(t, "copyright", readFile(t, path.Join(target, "usr/share/doc/app/copyright")))
+	assert.NoFileExists(t, path.Join(target, "control"))
+}
+
+func Test_Deb_Decompression_WithSubPath(t *testing.T) {
+	// a zstd-compressed payload
+	var payload bytes.Buffer
+	zw, err := zstd.NewWriter(&payload)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte(readFile(t, createTar(t, debPayload()))))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	deb := createDeb(t, [2]string{"debian-binary", "2.0\n"}, [2]string{"control.tar.xz", "control"}, [2]string{"data.tar.zst", payload.String()})
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	tt.opts.SubPath = "opt/vendor/app"
+	require.NoError(t, decompressArchive(deb, "deb", nil, tt))
+
+	entries, err := os.ReadDir(target)
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"bin", "lib", "current"}, names)
+	assert.Equal(t, "app", readFile(t, path.Join(target, "current/app")))
+}
+
+func Test_Deb_Decompression_WithoutPayload(t *testing.T) {
+	deb := createDeb(t, [2]string{"debian-binary", "2.0\n"}, [2]string{"control.tar.gz", "control"})
+	err := decompressArchive(deb, "", nil, testTarget(t, uuid.NewString()))
+	assert.EqualError(t, err, "data.tar member not found in package")
+}
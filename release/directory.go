@@ -0,0 +1,102 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// copy the directory tree under `sourceDir` to the target
+// the files' modes and symbolic links are preserved, whereas the files'
+// ownership is set to the target's uid/gid (as with archives)
+func copyDirectory(sourceDir string, t *target) error {
+	info, err := os.Stat(sourceDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", sourceDir)
+	}
+
+	err = filepath.Walk(sourceDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return err
+		}
+		// the root has already been created
+		if rel == "." {
+			return nil
+		}
+		// directory entries are named (and mapped) like archive entries
+		name, ok := t.entryName(filepath.ToSlash(rel))
+		if !ok {
+			return nil
+		}
+		if !t.included(name, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := t.countEntry(name, info.Size()); err != nil {
+			return err
+		}
+		targetPath, err := t.resolve(name)
+		if err != nil {
+			return err
+		}
+
+		mode := info.Mode()
+		if mode&os.ModeSymlink == 0 {
+			mode = t.permissions(name, mode)
+		}
+		switch {
+		case mode.IsDir():
+			if err := createDirectory(targetPath, mode, t.uid, t.gid); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", targetPath, err)
+			}
+			if err := t.setMode(targetPath, mode); err != nil {
+				return fmt.Errorf("failed to set mode of %s: %v", targetPath, err)
+			}
+			t.deferModTime(targetPath, info.ModTime())
+		case mode.IsRegular():
+			if err := copyFile(filePath, name, targetPath, mode, t); err != nil {
+				return entryError(err, "failed to create file %s", targetPath)
+			}
+			if err := t.setMode(targetPath, mode); err != nil {
+				return fmt.Errorf("failed to set mode of %s: %v", targetPath, err)
+			}
+			if err := t.setModTime(targetPath, info.ModTime()); err != nil {
+				return fmt.Errorf("failed to set modification time of %s: %v", targetPath, err)
+			}
+		case mode&os.ModeSymlink != 0:
+			linkname, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			if err := t.createSymlink(name, filepath.ToSlash(linkname), t.uid, t.gid); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %v", targetPath, err)
+			}
+		default:
+			return fmt.Errorf("unsupported file type: file=%s mode=%s", name, mode)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return t.finish()
+}
+
+func copyFile(filePath, name, targetPath string, mode os.FileMode, t *target) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return createFileCopy(t.meter(name, f), targetPath, mode, t.uid, t.gid)
+}
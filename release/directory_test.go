@@ -0,0 +1,75 @@
+package release
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CopyDirectory(t *testing.T) {
+	source := uuid.NewString()
+	defer os.RemoveAll(source)
+	require.NoError(t, os.MkdirAll(path.Join(source, "foo/empty"), 0750))
+	require.NoError(t, os.WriteFile(path.Join(source, "foo/bar.txt"), []byte("bar"), 0640))
+	require.NoError(t, os.WriteFile(path.Join(source, "run.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.Symlink("foo/bar.txt", path.Join(source, "link")))
+
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+	require.NoError(t, os.Mkdir(target, 0755))
+	require.NoError(t, copyDirectory(source, testTarget(t, target)))
+
+	assert.DirExists(t, path.Join(target, "foo/empty"))
+	contents, err := os.ReadFile(path.Join(target, "foo/bar.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(contents))
+	info, err := os.Stat(path.Join(target, "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	link, err := os.Readlink(path.Join(target, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo/bar.txt", link)
+}
+
+func Test_CopyDirectory_ShouldRejectLinksOutsideTarget(t *testing.T) {
+	source := uuid.NewString()
+	defer os.RemoveAll(source)
+	require.NoError(t, os.Mkdir(source, 0755))
+	require.NoError(t, os.Symlink("../../etc/passwd", path.Join(source, "evil")))
+
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+	require.NoError(t, os.Mkdir(target, 0755))
+	assert.ErrorContains(t, copyDirectory(source, testTarget(t, target)), `unsafe entry "evil"`)
+}
+
+func Test_CopyDirectory_ShouldMapPathsLikeArchives(t *testing.T) {
+	source := uuid.NewString()
+	defer os.RemoveAll(source)
+	require.NoError(t, os.MkdirAll(path.Join(source, "build/opt/app/bin"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(source, "build/opt/app/bin/tool"), []byte("tool"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(source, "build/opt/README"), []byte("readme"), 0644))
+
+	for _, opts := range []ExtractOptions{
+		{StripComponents: 1, SubPath: "opt/app"},
+		{StripComponents: 3},
+	} {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		tt := testTarget(t, target)
+		tt.opts.StripComponents, tt.opts.SubPath = opts.StripComponents, opts.SubPath
+		require.NoError(t, copyDirectory(source, tt))
+
+		contents, err := os.ReadFile(path.Join(target, "bin/tool"))
+		require.NoError(t, err)
+		assert.Equal(t, "tool", string(contents))
+		entries, err := os.ReadDir(target)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+		os.RemoveAll(target)
+	}
+}
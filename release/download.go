@@ -0,0 +1,321 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the default delay before retrying a failed download
+	// (it is doubled on every subsequent retry)
+	DefaultRetryDelay = time.Second
+	// the default time to wait for the server (see DownloadOptions)
+	DefaultDownloadTimeout = 30 * time.Second
+)
+
+// DownloadOptions control how archives are downloaded from HTTP(S) URLs
+type DownloadOptions struct {
+	// the expected sha256 checksum (in hex) of the archive
+	// if empty, then the archive's checksum is not verified
+	SHA256 string
+	// additional headers for the requests (e.g. Authorization)
+	Header http.Header
+	// the number of times a failed download is retried
+	// (the download resumes from where it stopped if the server allows it)
+	Retries int
+	// the delay before the first retry (see DefaultRetryDelay)
+	RetryDelay time.Duration
+	// the maximum time to wait for the server to accept the connection,
+	// to respond or to send more data (see DefaultDownloadTimeout)
+	Timeout time.Duration
+	// the directory under which a private directory is created for the
+	// download (defaults to the system's temporary directory)
+	Dir string
+}
+
+// is `path` the URL of an archive (instead of a local path)?
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// a source that is an archive file served over HTTP(S)
+type urlSource struct {
+	url, format string
+	opts        DownloadOptions
+	client      *http.Client
+	// the private directory of the download and the path
+	// of the downloaded archive (once the download is complete)
+	dir, path string
+	// the version of the archive (ETag or Last-Modified) that is being downloaded
+	validator string
+}
+
+// Create a source from the archive at the HTTP(S) `url`
+// The archive is downloaded to a local file (see DownloadOptions)
+// which is deleted when the release (or the check) is over
+// If `format` is empty, then it will be detected from the archive's contents
+func NewURLSource(url, format string, opts DownloadOptions) Source {
+	if opts.RetryDelay == 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultDownloadTimeout
+	}
+	return &urlSource{url: url, format: format, opts: opts, client: newHTTPClient(opts.Timeout)}
+}
+
+// create a client that gives up on servers that do not respond within `timeout`
+// (the response's body is subject to the same timeout, see fetch)
+func newHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		ForceAttemptHTTP2:     true,
+	}}
+}
+
+// the URL's password (if any) is not included in messages
+func (s *urlSource) String() string {
+	if u, err := url.Parse(s.url); err == nil {
+		return fmt.Sprintf("bundle=%s", u.Redacted())
+	}
+	return fmt.Sprintf("bundle=%s", s.url)
+}
+
+func (s *urlSource) populate(t *target) error {
+	p, err := s.download()
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %v", err)
+	}
+	if err := decompressArchive(p, s.format, nil, t); err != nil {
+		return fmt.Errorf("failed to decompress archive: %v", err)
+	}
+	return nil
+}
+
+func (s *urlSource) check(t *target) error {
+	p, err := s.download()
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %v", err)
+	}
+	t.expectArchive(p)
+	if err := decompressArchive(p, s.format, nil, t); err != nil {
+		return fmt.Errorf("invalid archive: %v", err)
+	}
+	return nil
+}
+
+// the archive is downloaded once and read from the local file
+func (s *urlSource) streamed() bool {
+	return false
+}
+
+// download the archive (unless already downloaded) and return its path
+func (s *urlSource) download() (string, error) {
+	if s.path != "" {
+		return s.path, nil
+	}
+	if s.opts.SHA256 != "" {
+		if b, err := hex.DecodeString(s.opts.SHA256); err != nil || len(b) != sha256.Size {
+			return "", fmt.Errorf("invalid sha256 checksum %q", s.opts.SHA256)
+		}
+	}
+	// the archive is downloaded to a directory that only we can access,
+	// so a download is only ever resumed from the bytes that we wrote
+	if s.opts.Dir != "" {
+		if err := os.MkdirAll(s.opts.Dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	dir, err := os.MkdirTemp(s.opts.Dir, "rv-download-")
+	if err != nil {
+		return "", err
+	}
+	s.dir = dir
+	p := filepath.Join(dir, "archive")
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		s.remove()
+		return "", err
+	}
+	defer f.Close()
+
+	delay := s.opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := s.fetch(f)
+		if err == nil {
+			break
+		}
+		if _, ok := err.(permanentError); ok || attempt >= s.opts.Retries {
+			s.remove()
+			return "", err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if err := verifyChecksum(f, s.opts.SHA256); err != nil {
+		s.remove()
+		return "", err
+	}
+	s.path = p
+	return p, nil
+}
+
+// a download error that is not resolved by retrying (e.g. 404)
+type permanentError struct {
+	error
+}
+
+// download the archive to `f` or resume the download if `f` is not empty;
+// the download is resumed only if the server confirms (using the validator
+// of the previous response) that the archive has not changed since
+func (s *urlSource) fetch(f *os.File) error {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	// the request is cancelled if the server stops sending data
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+	for name, values := range s.opts.Header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if offset > 0 && s.validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", s.validator)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// the whole archive (the server ignored the range or the archive has changed)
+		if err := f.Truncate(0); err != nil {
+			return permanentError{err}
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return permanentError{err}
+		}
+	case resp.StatusCode == http.StatusPartialContent:
+		if start, _ := contentRange(resp); start != offset {
+			// start over next time
+			f.Truncate(0)
+			return fmt.Errorf("unexpected range %q", resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// the archive had been fully downloaded already
+		if _, size := contentRange(resp); size == offset && req.Header.Get("Range") != "" {
+			return nil
+		}
+		f.Truncate(0)
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout:
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	default:
+		return permanentError{fmt.Errorf("unexpected response %s", resp.Status)}
+	}
+
+	// remember the archive's version so that the download can be resumed
+	s.validator = resp.Header.Get("ETag")
+	if s.validator == "" {
+		s.validator = resp.Header.Get("Last-Modified")
+	}
+	body := &idleReader{r: resp.Body, timeout: s.opts.Timeout, timer: time.AfterFunc(s.opts.Timeout, cancel)}
+	defer body.timer.Stop()
+	if _, err := io.Copy(f, body); err != nil {
+		if !body.timer.Stop() {
+			return fmt.Errorf("no data received for %v", s.opts.Timeout)
+		}
+		return err
+	}
+	return f.Sync()
+}
+
+// idleReader resets the `timer` every time that data is read from `r`,
+// i.e. the timer fires when no data has been read for `timeout`
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func (i *idleReader) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	if n > 0 {
+		i.timer.Reset(i.timeout)
+	}
+	return n, err
+}
+
+// return the start of the content range of a response and the size of
+// the whole archive (-1 if any of them is missing)
+func contentRange(resp *http.Response) (int64, int64) {
+	// e.g. "bytes 100-199/200" or "bytes */200"
+	r, size, ok := strings.Cut(strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes "), "/")
+	if !ok {
+		return -1, -1
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		n = -1
+	}
+	first, _, ok := strings.Cut(r, "-")
+	if !ok {
+		return -1, n
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1, n
+	}
+	return start, n
+}
+
+// verify that the contents of `f` have the sha256 checksum `expected` (if not empty)
+func verifyChecksum(f *os.File, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch: expected sha256 %s but got %s", strings.ToLower(expected), actual)
+	}
+	return nil
+}
+
+// delete the download's directory (if any)
+func (s *urlSource) remove() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+		s.dir, s.path = "", ""
+	}
+}
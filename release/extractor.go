@@ -0,0 +1,173 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the number of bytes at the beginning of an archive
+// that are passed to the extractors in order to detect its format
+const FormatHeaderSize = 512
+
+// Extractor extracts the archives of a specific format
+// Extractors are made available to rv using Register
+type Extractor interface {
+	// does the beginning of an archive (up to FormatHeaderSize bytes)
+	// match the format's signature?
+	Detect(header []byte) bool
+	// add the entries of the archive to the target
+	Extract(archive Archive, t Target) error
+}
+
+// Archive is the input of an Extractor
+type Archive interface {
+	// the archive's contents are streamed using Read
+	io.Reader
+	// provide random access to the whole archive (for formats like zip)
+	// archives read from a stream are buffered to a temporary file,
+	// so this should be called before reading anything from the archive
+	ReaderAt() (io.ReaderAt, int64, error)
+}
+
+// Target is the release directory to which an Extractor adds the archive's entries
+// The target applies the release's policies (limits, filters, ownership and
+// permissions) and makes sure that no entry is created outside the directory
+type Target interface {
+	// extract the entry `e`; the contents of regular files are read from `r`
+	// Entries that are filtered out are skipped; regular files (and only those)
+	// can be added concurrently by the tasks that are passed to Parallel
+	Add(e Entry, r io.Reader) error
+	// run the tasks using the target's workers and return the first error
+	Parallel(tasks []func() error) error
+}
+
+// EntryType is the type of an archive entry
+type EntryType int
+
+const (
+	TypeFile EntryType = iota
+	TypeDir
+	TypeSymlink
+	// hard links refer to another (already extracted) entry of the archive
+	TypeHardLink
+)
+
+// Entry describes an archive entry that is added to a Target
+type Entry struct {
+	// the entry's path inside the archive ("/"-separated)
+	Name string
+	Type EntryType
+	// the entry's permission bits, including os.ModeSetuid,
+	// os.ModeSetgid and os.ModeSticky
+	Mode os.FileMode
+	// the declared size of a regular file's contents
+	Size int64
+	// the target of a symbolic link or the archive path of a hard link's entry
+	Linkname string
+	// the entry's modification time (zero if not recorded in the archive)
+	ModTime time.Time
+	// the entry's ownership (nil if not recorded in the archive)
+	Owner *Owner
+}
+
+// Owner is the ownership of an archive entry
+type Owner struct {
+	Uid, Gid int
+	// the names take precedence over the ids if they exist locally
+	Uname, Gname string
+}
+
+// a registered archive format
+type archiveFormat struct {
+	name      string
+	aliases   []string
+	extractor Extractor
+}
+
+var (
+	formatsMu sync.RWMutex
+	// the registered formats in order of detection
+	formats []archiveFormat
+)
+
+// Register makes the extractor of an archive format available under
+// `name` (and `aliases`), both for detection and for explicit selection
+// Formats are detected in the order in which they are registered (the
+// built-in formats are registered first). Register panics if a name
+// is already registered.
+func Register(name string, x Extractor, aliases ...string) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if x == nil {
+		panic("release: Register extractor is nil")
+	}
+	for _, n := range append([]string{name}, aliases...) {
+		if _, ok := findFormat(n); ok {
+			panic("release: Register called twice for format " + n)
+		}
+	}
+	formats = append(formats, archiveFormat{name: name, aliases: aliases, extractor: x})
+}
+
+// return the names of all the supported archive formats
+func SupportedFormats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return supportedFormats()
+}
+
+func supportedFormats() []string {
+	names := []string{}
+	for _, f := range formats {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// return the extractor of the format with the given name or alias; if `name`
+// is empty, then the format is detected from the archive's `header`
+func lookupExtractor(name string, header []byte) (Extractor, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	if name == "" {
+		return detectFormat(header)
+	}
+	if f, ok := findFormat(name); ok {
+		return f.extractor, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %s (supported formats: %s)",
+		name, strings.Join(supportedFormats(), ", "))
+}
+
+// return the extractor whose signature matches the beginning of an archive
+func detectFormat(header []byte) (Extractor, error) {
+	for _, f := range formats {
+		if f.extractor.Detect(header) {
+			return f.extractor, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported archive type (supported types: %s)",
+		strings.Join(supportedFormats(), ", "))
+}
+
+func findFormat(name string) (archiveFormat, bool) {
+	for _, f := range formats {
+		if f.name == name || contains(f.aliases, name) {
+			return f, true
+		}
+	}
+	return archiveFormat{}, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
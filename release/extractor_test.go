@@ -0,0 +1,85 @@
+package release
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a test format that consists of a signature line followed by
+// lines of the form <path>=<contents>
+type lineExtractor struct{}
+
+const lineSignature = "RVLINES\n"
+
+func (lineExtractor) Detect(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(lineSignature))
+}
+
+func (lineExtractor) Extract(archive Archive, t Target) error {
+	scanner := bufio.NewScanner(archive)
+	scanner.Scan()
+	for scanner.Scan() {
+		name, contents, _ := strings.Cut(scanner.Text(), "=")
+		e := Entry{Name: name, Type: TypeFile, Mode: 0644, Size: int64(len(contents))}
+		if err := t.Add(e, strings.NewReader(contents)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func init() {
+	Register("lines", lineExtractor{}, "lns")
+}
+
+func createLines(t *testing.T, lines ...string) string {
+	archivePath := uuid.NewString()
+	contents := lineSignature + strings.Join(lines, "\n") + "\n"
+	require.NoError(t, os.WriteFile(archivePath, []byte(contents), 0644))
+	t.Cleanup(func() { os.Remove(archivePath) })
+	return archivePath
+}
+
+func Test_Register_ShouldAddFormat(t *testing.T) {
+	assert.Contains(t, SupportedFormats(), "lines")
+	archive := createLines(t, "bin/app=app", "README=readme", "docs/index.html=index")
+
+	for _, format := range []string{"", "lines", "lns"} {
+		workspace := uuid.NewString()
+		id, err := Install(workspace, NewArchiveSource(archive, format, nil),
+			InstallOptions{KeepN: 3, LockTimeout: time.Second, ExtractOptions: ExtractOptions{Exclude: []string{"docs"}}}, io.Discard)
+		require.NoError(t, err, format)
+
+		contents, err := os.ReadFile(path.Join(workspace, id, "bin/app"))
+		require.NoError(t, err)
+		assert.Equal(t, "app", string(contents))
+		assert.FileExists(t, path.Join(workspace, id, "README"))
+		assert.NoDirExists(t, path.Join(workspace, id, "docs"))
+		os.RemoveAll(workspace)
+	}
+}
+
+func Test_Register_ShouldEnforceTargetPolicies(t *testing.T) {
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+
+	err := decompressArchive(createLines(t, "../escape=foo"), "", nil, testTarget(t, target))
+	assert.ErrorContains(t, err, `unsafe entry "../escape"`)
+}
+
+func Test_Register_ShouldRejectDuplicateNames(t *testing.T) {
+	assert.Panics(t, func() { Register("zip", lineExtractor{}) })
+	assert.Panics(t, func() { Register("other-lines", lineExtractor{}, "tgz") })
+	assert.NotContains(t, SupportedFormats(), "other-lines")
+}
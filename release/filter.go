@@ -0,0 +1,58 @@
+package release
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// check that all the include/exclude patterns are valid
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// does the (archive) path `name` match any of the `patterns`?
+// Patterns follow the syntax of path.Match and:
+//   - a pattern that contains a "/" matches the path or any of its parent
+//     directories (e.g. "docs" or "web/*.map")
+//   - a pattern without a "/" matches any of the path's components
+//     anywhere in the tree (e.g. "*.map" or "__tests__")
+func matchesAny(patterns []string, name string) bool {
+	components := splitPath(name)
+	for _, pattern := range patterns {
+		if !strings.Contains(strings.Trim(pattern, "/"), "/") {
+			pattern = strings.Trim(pattern, "/")
+			for _, c := range components {
+				if ok, _ := path.Match(pattern, c); ok {
+					return true
+				}
+			}
+			continue
+		}
+		pattern = path.Clean(strings.Trim(pattern, "/"))
+		for idx := len(components); idx > 0; idx-- {
+			if ok, _ := path.Match(pattern, path.Join(components[:idx]...)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// should the entry `name` be extracted according to the target's
+// include/exclude patterns? Exclude patterns take precedence, whereas
+// include patterns only restrict the non-directory entries
+func (t *target) included(name string, isDir bool) bool {
+	if matchesAny(t.opts.Exclude, name) {
+		return false
+	}
+	if isDir || len(t.opts.Include) == 0 {
+		return true
+	}
+	return matchesAny(t.opts.Include, name)
+}
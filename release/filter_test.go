@@ -0,0 +1,85 @@
+package release
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MatchesAny(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		name    string
+		matches bool
+	}{
+		{"*.map", "static/js/app.js.map", true},
+		{"*.map", "static/js/app.js", false},
+		{"__tests__", "src/__tests__/foo.js", true},
+		{"__tests__/", "src/__tests__/", true},
+		{"docs", "docs/index.html", true},
+		{"docs", "src/docs.go", false},
+		{"web/*.map", "web/app.map", true},
+		{"web/*.map", "other/web/app.map", false},
+		{"web/assets", "web/assets/img/logo.png", true},
+		{"/web/assets/", "web/assets/img/logo.png", true},
+		{"bin/*", "bin/app", true},
+		{"bin/*", "lib/app", false},
+	} {
+		assert.Equal(t, tc.matches, matchesAny([]string{tc.pattern}, tc.name), "%s ~ %s", tc.pattern, tc.name)
+	}
+}
+
+func Test_ValidatePatterns(t *testing.T) {
+	assert.NoError(t, validatePatterns([]string{"*.map", "docs/[a-z]*"}))
+	assert.ErrorContains(t, validatePatterns([]string{"*.map", "docs/[a-z"}), `invalid pattern "docs/[a-z"`)
+}
+
+func Test_Decompression_WithIncludeAndExclude(t *testing.T) {
+	entries := []testEntry{
+		{name: "app/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "app/main.js", body: "main"},
+		{name: "app/main.js.map", body: "map"},
+		{name: "app/README.md", body: "readme"},
+		{name: "app/fixtures/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+		{name: "app/fixtures/data.js", body: "data"},
+	}
+	for _, archive := range []string{createTarGz(t, entries), createZip(t, entries)} {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		tt := testTarget(t, target)
+		tt.opts.Include = []string{"*.js", "*.map"}
+		tt.opts.Exclude = []string{"*.map", "app/fixtures"}
+
+		require.NoError(t, decompressArchive(archive, "", nil, tt), archive)
+		assert.FileExists(t, path.Join(target, "app/main.js"))
+		assert.NoFileExists(t, path.Join(target, "app/main.js.map"))
+		assert.NoFileExists(t, path.Join(target, "app/README.md"))
+		assert.NoDirExists(t, path.Join(target, "app/fixtures"))
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Decompression_ShouldRejectHardLinksToExcludedEntries(t *testing.T) {
+	archive := createTarGz(t, []testEntry{
+		{name: "app/data.bin", body: "data"},
+		{name: "app/link.bin", typeflag: tar.TypeLink, linkname: "app/data.bin"},
+	})
+	opts := ExtractOptions{Exclude: []string{"data.bin"}, Limits: DefaultLimits}
+	expected := "target app/data.bin has been filtered out by --include/--exclude"
+
+	// the archive is rejected both by the check and by the extraction
+	assert.ErrorContains(t, Check(NewArchiveSource(archive, "", nil), opts, io.Discard), expected)
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	tt.opts.Exclude = opts.Exclude
+	assert.ErrorContains(t, decompressArchive(archive, "", nil, tt), expected)
+}
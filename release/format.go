@@ -0,0 +1,68 @@
+package release
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// register the built-in archive formats in order of detection
+// compressed tar variants are detected by their compression signature
+// plain tar is detected by the ustar magic (which is why it's last)
+func init() {
+	Register("zip", zipExtractor{})
+	Register("deb", debExtractor{})
+	Register("tar.gz", tarExtractor{
+		detect: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte{0x1f, 0x8b})
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	}, "tgz")
+	Register("tar.xz", tarExtractor{
+		detect: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00})
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(xr), nil
+		},
+	}, "txz")
+	Register("tar.bz2", tarExtractor{
+		detect: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("BZh"))
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	}, "tbz2")
+	Register("tar.zst", tarExtractor{
+		detect: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd})
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	}, "tzst")
+	Register("tar", tarExtractor{
+		detect: func(header []byte) bool {
+			// both POSIX ("ustar\x00") and GNU ("ustar  \x00") archives
+			return len(header) >= 262 && string(header[257:262]) == "ustar"
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(r), nil
+		},
+	})
+}
@@ -0,0 +1,95 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// a source that is the tree of a commit in a local git repository
+type gitSource struct {
+	repo, ref string
+	// the commit that `ref` resolves to (resolved once, so that
+	// the contents that are checked are the ones that are released)
+	commit string
+}
+
+// Create a source from the tree of `ref` (e.g. a branch, a tag or
+// a commit) in the git repository at `repo`; the git command must
+// be available
+func NewGitSource(repo, ref string) Source {
+	return &gitSource{repo: repo, ref: ref}
+}
+
+func (s *gitSource) String() string {
+	return fmt.Sprintf("git=%s@%s", s.repo, s.ref)
+}
+
+func (s *gitSource) populate(t *target) error {
+	if err := s.export(t); err != nil {
+		return fmt.Errorf("failed to export tree: %v", err)
+	}
+	return nil
+}
+
+func (s *gitSource) check(t *target) error {
+	if err := s.export(t); err != nil {
+		return fmt.Errorf("invalid tree: %v", err)
+	}
+	return nil
+}
+
+func (s *gitSource) streamed() bool {
+	return false
+}
+
+// export the tree of the source's commit to the target using git-archive(1)
+func (s *gitSource) export(t *target) error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", s.repo, "archive", "--format=tar", s.commit)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run git: %v", err)
+	}
+	err = ExtractTar(&countingReader{r: stdout, n: &t.archiveSize}, t)
+	if err != nil {
+		// the rest of the tree is of no use
+		cmd.Process.Kill()
+	} else {
+		// consume the rest of the output (e.g. the archive's padding) so that git can exit
+		io.Copy(io.Discard, stdout)
+	}
+	if waitErr := cmd.Wait(); waitErr != nil && err == nil {
+		err = fmt.Errorf("git archive failed: %v (%s)", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return err
+	}
+	t.commit = s.commit
+	return t.finish()
+}
+
+// resolve the source's ref to a commit
+func (s *gitSource) resolve() error {
+	if s.commit != "" {
+		return nil
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", s.repo, "rev-parse", "--verify", "--end-of-options", s.ref+"^{commit}")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v (%s)", s.ref, err, strings.TrimSpace(stderr.String()))
+	}
+	s.commit = strings.TrimSpace(string(out))
+	return nil
+}
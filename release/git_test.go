@@ -0,0 +1,110 @@
+package release
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run git in `repo` and return its output
+func runGit(t *testing.T, repo string, args ...string) string {
+	args = append([]string{"-C", repo, "-c", "user.name=rv", "-c", "user.email=rv@example.com"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// create a git repository with two commits (the first one is tagged v1)
+// and return its path and the commits' ids
+func createGitRepo(t *testing.T) (string, string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	repo := uuid.NewString()
+	require.NoError(t, os.Mkdir(repo, 0755))
+	t.Cleanup(func() { os.RemoveAll(repo) })
+	runGit(t, repo, "init", "-q")
+
+	require.NoError(t, os.MkdirAll(path.Join(repo, "bin"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(repo, "bin/tool"), []byte("v1"), 0755))
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "first")
+	runGit(t, repo, "tag", "v1")
+	first := runGit(t, repo, "rev-parse", "HEAD")
+
+	require.NoError(t, os.WriteFile(path.Join(repo, "bin/tool"), []byte("v2"), 0755))
+	// untracked files are not released
+	require.NoError(t, os.WriteFile(path.Join(repo, "scratch.txt"), []byte("scratch"), 0644))
+	runGit(t, repo, "commit", "-q", "-a", "-m", "second")
+	second := runGit(t, repo, "rev-parse", "HEAD")
+	return repo, first, second
+}
+
+func Test_Git_ShouldReleaseTreeOfRef(t *testing.T) {
+	repo, first, second := createGitRepo(t)
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	opts := InstallOptions{KeepN: 3, LockTimeout: time.Second}
+	id1, err := Install(workspace, NewGitSource(repo, "v1"), opts, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", readFile(t, path.Join(workspace, id1, "bin/tool")))
+
+	time.Sleep(2 * time.Millisecond)
+	id2, err := Install(workspace, NewGitSource(repo, "HEAD"), opts, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", readFile(t, path.Join(workspace, id2, "bin/tool")))
+	assert.NoFileExists(t, path.Join(workspace, id2, "scratch.txt"))
+	info, err := os.Stat(path.Join(workspace, id2, "bin/tool"))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100)
+
+	releases, err := List(workspace)
+	require.NoError(t, err)
+	assert.Equal(t, []string{id2 + " commit=" + second + " <== current", id1 + " commit=" + first}, releases)
+}
+
+func Test_Git_ShouldRemoveReleaseInformation(t *testing.T) {
+	repo, _, _ := createGitRepo(t)
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	opts := InstallOptions{KeepN: 1, LockTimeout: time.Second}
+	id1, err := Install(workspace, NewGitSource(repo, "v1"), opts, io.Discard)
+	require.NoError(t, err)
+	assert.FileExists(t, releaseInfoPath(workspace, id1))
+
+	time.Sleep(2 * time.Millisecond)
+	id2, err := Install(workspace, NewGitSource(repo, "HEAD"), opts, io.Discard)
+	require.NoError(t, err)
+	assert.NoFileExists(t, releaseInfoPath(workspace, id1))
+	assert.FileExists(t, releaseInfoPath(workspace, id2))
+}
+
+func Test_Git_WithUnknownRef(t *testing.T) {
+	repo, _, _ := createGitRepo(t)
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	_, err := Install(workspace, NewGitSource(repo, "v3"), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+	assert.ErrorContains(t, err, "invalid tree: failed to resolve v3")
+	assert.NoDirExists(t, workspace)
+}
+
+func Test_Git_ShouldStopOnInvalidTree(t *testing.T) {
+	repo, _, _ := createGitRepo(t)
+
+	// the export fails with the extraction's error (not with git's)
+	err := Check(NewGitSource(repo, "v1"), ExtractOptions{Limits: Limits{MaxFiles: 1}}, io.Discard)
+	assert.ErrorContains(t, err, "invalid tree: ")
+	assert.ErrorContains(t, err, "archive exceeds the maximum number of entries (1)")
+	assert.NotContains(t, err.Error(), "git archive failed")
+}
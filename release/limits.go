@@ -0,0 +1,118 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// the compression ratio limit is not enforced until this many bytes
+// have been extracted, since small archives (e.g. of text files) can
+// easily have high compression ratios and do not pose any danger
+const ratioGraceSize = 1 << 20
+
+// Limits protect the workspace against archives that expand to unreasonable
+// sizes (e.g. decompression bombs); a zero value disables the respective limit
+type Limits struct {
+	// the maximum number of bytes extracted from the archive
+	MaxTotalSize int64
+	// the maximum size of a single extracted file
+	MaxFileSize int64
+	// the maximum number of entries (files, directories, links) in the archive
+	MaxFiles int64
+	// the maximum ratio of the extracted bytes to the size of the archive
+	MaxRatio float64
+}
+
+// the limits that apply unless specified otherwise
+var DefaultLimits = Limits{
+	MaxTotalSize: 16 << 30,
+	MaxFileSize:  0,
+	MaxFiles:     1000000,
+	MaxRatio:     200,
+}
+
+// account for a new archive entry (with a declared size)
+func (t *target) countEntry(name string, size int64) error {
+	entries := atomic.AddInt64(&t.entries, 1)
+	if t.opts.Limits.MaxFiles > 0 && entries > t.opts.Limits.MaxFiles {
+		return fmt.Errorf("entry %q: archive exceeds the maximum number of entries (%d)", name, t.opts.Limits.MaxFiles)
+	}
+	if t.opts.Limits.MaxFileSize > 0 && size > t.opts.Limits.MaxFileSize {
+		return fmt.Errorf("entry %q: file exceeds the maximum file size (%d bytes)", name, t.opts.Limits.MaxFileSize)
+	}
+	return nil
+}
+
+// account for `n` more bytes extracted from the archive entry `name`
+// whose size is now `size` bytes
+func (t *target) countBytes(name string, n, size int64) error {
+	written := atomic.AddInt64(&t.written, n)
+	if t.opts.Limits.MaxFileSize > 0 && size > t.opts.Limits.MaxFileSize {
+		return fmt.Errorf("entry %q: file exceeds the maximum file size (%d bytes)", name, t.opts.Limits.MaxFileSize)
+	}
+	// the following limits apply to the archive as a whole, so the errors
+	// do not name the entry (with concurrent workers, the entry that notices
+	// the violation is not necessarily the one that caused it)
+	if t.opts.Limits.MaxTotalSize > 0 && written > t.opts.Limits.MaxTotalSize {
+		return archiveLimitError{fmt.Errorf("archive exceeds the maximum extracted size (%d bytes)", t.opts.Limits.MaxTotalSize)}
+	}
+	if archiveSize := atomic.LoadInt64(&t.archiveSize); t.opts.Limits.MaxRatio > 0 && archiveSize > 0 &&
+		written > ratioGraceSize && float64(written)/float64(archiveSize) > t.opts.Limits.MaxRatio {
+		return archiveLimitError{fmt.Errorf("archive exceeds the maximum compression ratio (%g)", t.opts.Limits.MaxRatio)}
+	}
+	return nil
+}
+
+// the violation of a limit that applies to the archive as a whole
+// (it is not wrapped with the name of the entry that was being extracted)
+type archiveLimitError struct {
+	error
+}
+
+// wrap the `err` of an archive entry with the entry's description,
+// unless it is an archiveLimitError
+func entryError(err error, format string, args ...interface{}) error {
+	if _, ok := err.(archiveLimitError); ok {
+		return err
+	}
+	return fmt.Errorf(format+": %v", append(args, err)...)
+}
+
+// wrap the contents of the archive entry `name` so that the target's
+// limits are enforced as the contents are being extracted
+func (t *target) meter(name string, r io.Reader) io.Reader {
+	return &meteredReader{r: r, t: t, name: name}
+}
+
+type meteredReader struct {
+	r    io.Reader
+	t    *target
+	name string
+	size int64
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	// another worker has failed, so there's no point in going on
+	if m.t.aborted.Load() {
+		return 0, errAborted
+	}
+	n, err := m.r.Read(p)
+	m.size += int64(n)
+	if lerr := m.t.countBytes(m.name, int64(n), m.size); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
+
+// countingReader keeps track of the number of bytes read from `r`
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
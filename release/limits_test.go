@@ -0,0 +1,56 @@
+package release
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Decompression_ShouldEnforceLimits(t *testing.T) {
+	entries := []testEntry{
+		{name: "foo/", mode: os.ModeDir | 0755, typeflag: '5'},
+		{name: "foo/bar.txt", body: strings.Repeat("a", 1000)},
+		{name: "foo/baz.txt", body: strings.Repeat("b", 3000)},
+	}
+	for _, tc := range []struct {
+		limits Limits
+		err    string
+	}{
+		{Limits{MaxFiles: 2}, `entry "foo/baz.txt": archive exceeds the maximum number of entries (2)`},
+		{Limits{MaxFileSize: 2000}, `entry "foo/baz.txt": file exceeds the maximum file size (2000 bytes)`},
+		{Limits{MaxTotalSize: 3500}, "archive exceeds the maximum extracted size (3500 bytes)"},
+	} {
+		for _, archive := range []string{createTarGz(t, entries), createZip(t, entries)} {
+			target := uuid.NewString()
+			tt := testTarget(t, target)
+			tt.opts.Limits = tc.limits
+			assert.ErrorContains(t, decompressArchive(archive, "", nil, tt), tc.err, archive)
+			os.RemoveAll(target)
+		}
+	}
+}
+
+func Test_Decompression_ShouldEnforceCompressionRatio(t *testing.T) {
+	// 4MiB of zeros compress really well
+	entries := []testEntry{{name: "zeros", body: strings.Repeat("\x00", 4<<20)}}
+
+	for _, archive := range []string{createTarGz(t, entries), createZip(t, entries)} {
+		target := uuid.NewString()
+		require.NoError(t, os.MkdirAll(target, 0755))
+		tt := testTarget(t, target)
+		tt.opts.Limits = Limits{MaxRatio: 100}
+		assert.ErrorContains(t, decompressArchive(archive, "", nil, tt), "archive exceeds the maximum compression ratio (100)")
+		os.RemoveAll(target)
+
+		// but it's ok if we're more permissive
+		require.NoError(t, os.MkdirAll(target, 0755))
+		tt = testTarget(t, target)
+		tt.opts.Limits = Limits{MaxRatio: 10000}
+		assert.NoError(t, decompressArchive(archive, "", nil, tt))
+		os.RemoveAll(target)
+	}
+}
@@ -0,0 +1,88 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MetadataDirName is the hidden directory inside the workspace
+	// where rv keeps its own bookkeeping files
+	MetadataDirName = ".rv"
+	lockFileName    = "lock"
+)
+
+// how often we retry acquiring a workspace lock that is held by someone else
+var lockRetryInterval = 50 * time.Millisecond
+
+// workspaceLock is an advisory lock on a workspace that is held
+// for the duration of every operation that mutates the workspace
+type workspaceLock struct {
+	f *os.File
+}
+
+// lock the workspace, creating the workspace and the lock file if necessary
+// If the lock is held by another process, we'll keep retrying until `timeout`
+// expires; then the returned error will contain the pid of the lock holder
+func lockWorkspace(workspaceDir string, timeout time.Duration) (*workspaceLock, error) {
+	metaDir := path.Join(workspaceDir, MetadataDirName)
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", metaDir, err)
+	}
+	lockPath := path.Join(metaDir, lockFileName)
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		acquired, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %v", lockPath, err)
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("workspace %s is locked by another rv process (pid=%s, lock=%s)",
+				workspaceDir, lockHolder(lockPath), lockPath)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	// record our pid so that others can tell who holds the lock
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return &workspaceLock{f: f}, nil
+}
+
+// release the lock
+// the lock file is not deleted since that would allow another process
+// to lock a file that is no longer linked to the workspace
+func (l *workspaceLock) Unlock() error {
+	defer l.f.Close()
+	l.f.Truncate(0)
+	return unlockFile(l.f)
+}
+
+// return the pid recorded in the lock file (or "unknown")
+func lockHolder(lockPath string) string {
+	contents, err := os.ReadFile(lockPath)
+	if err != nil {
+		return "unknown"
+	}
+	pid := strings.TrimSpace(string(contents))
+	if pid == "" {
+		return "unknown"
+	}
+	return pid
+}
@@ -0,0 +1,72 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Install_ShouldFail_WhenWorkspaceIsLocked(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	lock, err := lockWorkspace(workspace, 0)
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	_, err = Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 3, LockTimeout: 100 * time.Millisecond}, io.Discard)
+	assert.ErrorContains(t, err, fmt.Sprintf("locked by another rv process (pid=%d", os.Getpid()))
+
+	releases, err := getReleases(workspace)
+	require.NoError(t, err)
+	assert.Empty(t, releases)
+}
+
+func Test_Install_ShouldWaitForLock(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	lock, err := lockWorkspace(workspace, 0)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lock.Unlock()
+	}()
+
+	_, err = Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 3, LockTimeout: 5 * time.Second}, io.Discard)
+	require.NoError(t, err)
+
+	releases, err := getReleases(workspace)
+	require.NoError(t, err)
+	assert.Len(t, releases, 1)
+}
+
+func Test_Rewind_ShouldFail_WhenWorkspaceIsLocked(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(2 * time.Millisecond)
+		_, err := Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+		require.NoError(t, err)
+	}
+	current, err := GetCurrent(workspace)
+	require.NoError(t, err)
+
+	lock, err := lockWorkspace(workspace, 0)
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	_, err = Rewind(workspace, "", 100*time.Millisecond, io.Discard)
+	assert.ErrorContains(t, err, "locked by another rv process")
+
+	after, err := GetCurrent(workspace)
+	require.NoError(t, err)
+	assert.Equal(t, current, after)
+}
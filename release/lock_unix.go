@@ -0,0 +1,22 @@
+//go:build !windows
+
+package release
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// try to acquire an exclusive flock(2) on `f` without blocking
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,66 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// the information about each release is kept under this directory
+// (inside the workspace's metadata directory)
+const releasesDirName = "releases"
+
+// releaseInfo is the information that is recorded about a release
+type releaseInfo struct {
+	// the source of the release's contents
+	Source string `json:"source"`
+	// the commit from which the release was exported (git sources only)
+	Commit string `json:"commit,omitempty"`
+}
+
+func releaseInfoPath(workspaceDir, id string) string {
+	return path.Join(workspaceDir, MetadataDirName, releasesDirName, id+".json")
+}
+
+// record the information about the release `id`
+func writeReleaseInfo(workspaceDir, id string, info releaseInfo) error {
+	p := releaseInfoPath(workspaceDir, id)
+	if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	contents, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, contents, 0644)
+}
+
+// return the recorded information about the release `id`
+// (or nil if nothing has been recorded, e.g. for older releases)
+func readReleaseInfo(workspaceDir, id string) (*releaseInfo, error) {
+	contents, err := os.ReadFile(releaseInfoPath(workspaceDir, id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &releaseInfo{}
+	if err := json.Unmarshal(contents, info); err != nil {
+		return nil, fmt.Errorf("invalid information about release %s: %v", id, err)
+	}
+	return info, nil
+}
+
+// delete the release `id` along with its recorded information
+func removeRelease(workspaceDir, id string) error {
+	releasePath := path.Join(workspaceDir, id)
+	if err := os.RemoveAll(releasePath); err != nil {
+		return fmt.Errorf("failed to delete release %s: %v", releasePath, err)
+	}
+	if err := os.Remove(releaseInfoPath(workspaceDir, id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete information about release %s: %v", id, err)
+	}
+	return nil
+}
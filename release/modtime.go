@@ -0,0 +1,39 @@
+package release
+
+import (
+	"os"
+	"time"
+)
+
+type dirModTime struct {
+	path    string
+	modTime time.Time
+}
+
+// set the modification time of the extracted file at `p`
+func (t *target) setModTime(p string, modTime time.Time) error {
+	if t.opts.Touch || modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(p, modTime, modTime)
+}
+
+// remember the modification time of the extracted directory at `p`; it
+// will be applied when the extraction is complete since the extraction
+// of the directory's contents will update the directory's time
+func (t *target) deferModTime(p string, modTime time.Time) {
+	if t.opts.Touch || modTime.IsZero() {
+		return
+	}
+	t.dirModTimes = append(t.dirModTimes, dirModTime{path: p, modTime: modTime})
+}
+
+func (t *target) restoreDirModTimes() error {
+	for _, d := range t.dirModTimes {
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			return err
+		}
+	}
+	t.dirModTimes = nil
+	return nil
+}
@@ -0,0 +1,75 @@
+package release
+
+import (
+	"archive/tar"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Decompression_ShouldPreserveModTimes(t *testing.T) {
+	dirTime := time.Date(2023, 2, 23, 13, 23, 0, 0, time.UTC)
+	fileTime := time.Date(2022, 1, 2, 3, 4, 6, 0, time.UTC)
+	entries := []testEntry{
+		{name: "foo/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755, modTime: dirTime},
+		{name: "foo/bar.txt", body: "bar", modTime: fileTime},
+		{name: "foo/baz.txt", body: "baz", modTime: fileTime},
+	}
+
+	for _, archive := range []string{createTarGz(t, entries), createZip(t, entries)} {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		require.NoError(t, decompressArchive(archive, "", nil, testTarget(t, target)))
+
+		info, err := os.Stat(path.Join(target, "foo"))
+		require.NoError(t, err)
+		assert.True(t, dirTime.Equal(info.ModTime()), "%s: %v", archive, info.ModTime())
+		info, err = os.Stat(path.Join(target, "foo/bar.txt"))
+		require.NoError(t, err)
+		assert.True(t, fileTime.Equal(info.ModTime()), "%s: %v", archive, info.ModTime())
+
+		os.RemoveAll(target)
+	}
+}
+
+func Test_Decompression_WithTouch(t *testing.T) {
+	fileTime := time.Date(2022, 1, 2, 3, 4, 6, 0, time.UTC)
+	archive := createTarGz(t, []testEntry{{name: "bar.txt", body: "bar", modTime: fileTime}})
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	tt.opts.Touch = true
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+
+	info, err := os.Stat(path.Join(target, "bar.txt"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+}
+
+func Test_CopyDirectory_ShouldPreserveModTimes(t *testing.T) {
+	modTime := time.Date(2022, 1, 2, 3, 4, 6, 0, time.UTC)
+	source := uuid.NewString()
+	defer os.RemoveAll(source)
+	require.NoError(t, os.MkdirAll(path.Join(source, "foo"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(source, "foo/bar.txt"), []byte("bar"), 0644))
+	require.NoError(t, os.Chtimes(path.Join(source, "foo/bar.txt"), modTime, modTime))
+	require.NoError(t, os.Chtimes(path.Join(source, "foo"), modTime, modTime))
+
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+	require.NoError(t, os.Mkdir(target, 0755))
+	require.NoError(t, copyDirectory(source, testTarget(t, target)))
+
+	for _, p := range []string{"foo", "foo/bar.txt"} {
+		info, err := os.Stat(path.Join(target, p))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(info.ModTime()), p)
+	}
+}
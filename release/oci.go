@@ -0,0 +1,328 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	ociIndexMediaType  = "application/vnd.oci.image.index.v1+json"
+	ociImageMediaType  = "application/vnd.oci.image.manifest.v1+json"
+	ociRefNameKey      = "org.opencontainers.image.ref.name"
+	whiteoutPrefix     = ".wh."
+	whiteoutOpaqueName = ".wh..wh..opq"
+)
+
+// a content descriptor of an OCI image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *ociPlatform      `json:"platform"`
+}
+
+// the platform of an image
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+}
+
+// an image index (e.g. index.json) or an image manifest
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// a source that is the filesystem of an image in an OCI image layout
+type ociSource struct {
+	layout, tag string
+}
+
+// Create a source from the image layout directory specified by `ref`,
+// which has the form <layout-dir>[:tag]; the tag may be omitted
+// if the layout contains a single image
+func NewOCISource(ref string) Source {
+	s := &ociSource{layout: ref}
+	// the tag can not contain path separators (unlike e.g. C:\layout)
+	if idx := strings.LastIndex(ref, ":"); idx > 0 && !strings.ContainsAny(ref[idx+1:], `/\`) {
+		s.layout, s.tag = ref[:idx], ref[idx+1:]
+	}
+	return s
+}
+
+func (s *ociSource) String() string {
+	if s.tag == "" {
+		return fmt.Sprintf("oci=%s", s.layout)
+	}
+	return fmt.Sprintf("oci=%s:%s", s.layout, s.tag)
+}
+
+func (s *ociSource) populate(t *target) error {
+	if err := s.applyLayers(t); err != nil {
+		return fmt.Errorf("failed to extract image: %v", err)
+	}
+	return nil
+}
+
+func (s *ociSource) check(t *target) error {
+	if err := s.applyLayers(t); err != nil {
+		return fmt.Errorf("invalid image: %v", err)
+	}
+	return nil
+}
+
+func (s *ociSource) streamed() bool {
+	return false
+}
+
+// extract the image's layers to the target in order
+func (s *ociSource) applyLayers(t *target) error {
+	manifest, err := s.manifest()
+	if err != nil {
+		return err
+	}
+	blobs := make([]string, len(manifest.Layers))
+	for idx, layer := range manifest.Layers {
+		if blobs[idx], err = s.blobPath(layer); err != nil {
+			return err
+		}
+		t.expectArchive(blobs[idx])
+	}
+	for idx, layer := range manifest.Layers {
+		// the layer's compression is detected from its contents
+		if err := extractArchive(blobs[idx], "", nil, t, newLayerTarget(t)); err != nil {
+			return fmt.Errorf("layer %s: %v", layer.Digest, err)
+		}
+	}
+	return t.finish()
+}
+
+// find the manifest of the image with the source's tag
+func (s *ociSource) manifest() (*ociManifest, error) {
+	index := &ociManifest{}
+	if err := readJSON(filepath.Join(s.layout, "index.json"), index); err != nil {
+		return nil, fmt.Errorf("failed to read image index: %v", err)
+	}
+	tag := s.tag
+	for {
+		d, err := selectManifest(index.Manifests, tag)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := s.blobPath(d)
+		if err != nil {
+			return nil, err
+		}
+		manifest := &ociManifest{}
+		if err := readJSON(blob, manifest); err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %v", d.Digest, err)
+		}
+		// the manifest's media type is optional (the descriptor's applies then)
+		mediaType := manifest.MediaType
+		if mediaType == "" {
+			mediaType = d.MediaType
+		}
+		switch mediaType {
+		case ociIndexMediaType:
+			// an index of the image's variants (e.g. one per platform)
+			index, tag = manifest, ""
+			continue
+		case ociImageMediaType:
+			if len(manifest.Layers) == 0 {
+				return nil, fmt.Errorf("manifest %s has no layers", d.Digest)
+			}
+			return manifest, nil
+		default:
+			return nil, fmt.Errorf("manifest %s has unsupported media type %q", d.Digest, mediaType)
+		}
+	}
+}
+
+// select the descriptor of the image with the given tag (if any)
+// among `manifests`; images for other platforms are ignored
+func selectManifest(manifests []ociDescriptor, tag string) (ociDescriptor, error) {
+	candidates := []ociDescriptor{}
+	for _, d := range manifests {
+		if tag != "" && d.Annotations[ociRefNameKey] != tag {
+			continue
+		}
+		if d.Platform != nil && (d.Platform.OS != runtime.GOOS || d.Platform.Architecture != runtime.GOARCH) {
+			continue
+		}
+		candidates = append(candidates, d)
+	}
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case len(candidates) == 0 && tag != "":
+		return ociDescriptor{}, fmt.Errorf("image %s not found", tag)
+	case len(candidates) == 0:
+		return ociDescriptor{}, fmt.Errorf("no image found for %s/%s", runtime.GOOS, runtime.GOARCH)
+	default:
+		return ociDescriptor{}, fmt.Errorf("found %d images, please specify a tag", len(candidates))
+	}
+}
+
+// return the path of the blob that is described by `d`
+// after verifying that its contents match the digest
+func (s *ociSource) blobPath(d ociDescriptor) (string, error) {
+	algorithm, encoded, ok := strings.Cut(d.Digest, ":")
+	if !ok || algorithm != "sha256" || len(encoded) != sha256.Size*2 || strings.ContainsAny(encoded, `/\.`) {
+		return "", fmt.Errorf("unsupported digest %q", d.Digest)
+	}
+	p := filepath.Join(s.layout, "blobs", algorithm, encoded)
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != encoded {
+		return "", fmt.Errorf("blob %s does not match its digest", d.Digest)
+	}
+	return p, nil
+}
+
+func readJSON(p string, v interface{}) error {
+	contents, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, v)
+}
+
+// layerTarget adds the entries of an image layer to the target; whiteout
+// entries remove the files that were extracted from the previous layers
+// (but not the ones that were added by the layer itself)
+type layerTarget struct {
+	*target
+	mu sync.Mutex
+	// the (resolved) paths of the entries that have been added by the
+	// layer and of their parent directories
+	added map[string]bool
+}
+
+func newLayerTarget(t *target) *layerTarget {
+	return &layerTarget{target: t, added: map[string]bool{}}
+}
+
+func (l *layerTarget) Add(e Entry, r io.Reader) error {
+	name, ok := l.entryName(e.Name)
+	if !strings.HasPrefix(path.Base(e.Name), whiteoutPrefix) {
+		if err := l.target.Add(e, r); err != nil || !ok {
+			return err
+		}
+		p, err := l.resolve(name)
+		if err != nil {
+			return err
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for ; p != l.root && !l.added[p]; p = filepath.Dir(p) {
+			l.added[p] = true
+		}
+		return nil
+	}
+	// whiteouts are subject to the same path mapping as the rest of the entries
+	if !ok {
+		return nil
+	}
+	dir, base := path.Split(name)
+	if base == whiteoutOpaqueName {
+		// the directory's contents are replaced by the layer's contents
+		return l.whiteout(path.Clean(dir), true)
+	}
+	return l.whiteout(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), false)
+}
+
+// was `p` (or anything under it) added by the layer?
+func (l *layerTarget) keeps(p string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.added[p]
+}
+
+// remove the extracted file (or directory) `name` or, if `contentsOnly`
+// is true, the contents of the extracted directory `name`; the entries
+// that have been added by the layer itself are kept
+func (l *layerTarget) whiteout(name string, contentsOnly bool) error {
+	t := l.target
+	filePath, err := t.resolve(name)
+	if err != nil {
+		return err
+	}
+	// forget the links and directories that are removed
+	removed := func(p string) bool {
+		return ((p == filePath && !contentsOnly) || strings.HasPrefix(p, filePath+string(filepath.Separator)) || filePath == t.root) && !l.keeps(p)
+	}
+	kept := t.dirModTimes[:0]
+	for _, d := range t.dirModTimes {
+		if !removed(d.path) {
+			kept = append(kept, d)
+		}
+	}
+	t.dirModTimes = kept
+	links := t.symlinks[:0]
+	for _, link := range t.symlinks {
+		if p, err := t.resolve(link[0]); err != nil || !removed(p) {
+			links = append(links, link)
+		}
+	}
+	t.symlinks = links
+
+	if t.dryRun != nil {
+		t.dryRun.forgetAll(removed)
+		return nil
+	}
+	if !contentsOnly {
+		return l.prune(filePath)
+	}
+	entries, err := os.ReadDir(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := l.prune(filepath.Join(filePath, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove `p` and everything under it except for the entries that
+// were added by the layer (and their parent directories)
+func (l *layerTarget) prune(p string) error {
+	if !l.keeps(p) {
+		return os.RemoveAll(p)
+	}
+	info, err := os.Lstat(p)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := l.prune(filepath.Join(p, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
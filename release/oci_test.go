@@ -0,0 +1,211 @@
+package release
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write `contents` as a blob of the image layout and return its descriptor
+func writeBlob(t *testing.T, layout, mediaType string, contents []byte) ociDescriptor {
+	sum := sha256.Sum256(contents)
+	encoded := hex.EncodeToString(sum[:])
+	require.NoError(t, os.MkdirAll(path.Join(layout, "blobs/sha256"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(layout, "blobs/sha256", encoded), contents, 0644))
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + encoded}
+}
+
+// create an image layout with a single image (tagged `tag`) that consists
+// of the given layers and return the layout's path
+func createOCILayout(t *testing.T, tag string, layers ...[]testEntry) string {
+	layout := uuid.NewString()
+	t.Cleanup(func() { os.RemoveAll(layout) })
+
+	manifest := ociManifest{MediaType: ociImageMediaType}
+	for _, entries := range layers {
+		contents, err := os.ReadFile(createTarGz(t, entries))
+		require.NoError(t, err)
+		manifest.Layers = append(manifest.Layers, writeBlob(t, layout, "application/vnd.oci.image.layer.v1.tar+gzip", contents))
+	}
+	contents, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	d := writeBlob(t, layout, manifest.MediaType, contents)
+	d.Annotations = map[string]string{ociRefNameKey: tag}
+
+	contents, err = json.Marshal(ociManifest{Manifests: []ociDescriptor{d}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(layout, "index.json"), contents, 0644))
+	return layout
+}
+
+// the layers of a test image
+func ociLayers() [][]testEntry {
+	return [][]testEntry{
+		{
+			{name: "app/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "app/old.txt", body: "old"},
+			{name: "app/keep.txt", body: "keep"},
+			{name: "app/cache/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "app/cache/a", body: "a"},
+			{name: "app/cache/link", typeflag: tar.TypeSymlink, linkname: "a"},
+		},
+		{
+			{name: "app/.wh.old.txt"},
+			{name: "app/cache/.wh..wh..opq"},
+			{name: "app/cache/b", body: "b"},
+			{name: "app/new.txt", body: "new"},
+		},
+	}
+}
+
+func Test_OCI_ShouldApplyLayersInOrder(t *testing.T) {
+	layout := createOCILayout(t, "v1", ociLayers()...)
+
+	for _, ref := range []string{layout, layout + ":v1"} {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		require.NoError(t, NewOCISource(ref).populate(testTarget(t, target)), ref)
+
+		assert.Equal(t, "keep", readFile(t, path.Join(target, "app/keep.txt")))
+		assert.Equal(t, "new", readFile(t, path.Join(target, "app/new.txt")))
+		assert.NoFileExists(t, path.Join(target, "app/old.txt"))
+		entries, err := os.ReadDir(path.Join(target, "app/cache"))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "b", entries[0].Name())
+		os.RemoveAll(target)
+	}
+}
+
+func Test_OCI_WhiteoutsShouldOnlyHideLowerLayers(t *testing.T) {
+	layout := createOCILayout(t, "v1",
+		[]testEntry{
+			{name: "app/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "app/lower.txt", body: "lower"},
+			{name: "app/data/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "app/data/lower.txt", body: "lower"},
+		},
+		[]testEntry{
+			// the layer's own entries precede its whiteouts
+			{name: "app/a.txt", body: "a"},
+			{name: "app/data/new.txt", body: "new"},
+			{name: "app/.wh..wh..opq"},
+			{name: "app/b.txt", body: "b"},
+			{name: "app/.wh.b.txt"},
+		},
+	)
+
+	require.NoError(t, Check(NewOCISource(layout), ExtractOptions{}, io.Discard))
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	require.NoError(t, NewOCISource(layout).populate(testTarget(t, target)))
+
+	assert.Equal(t, "a", readFile(t, path.Join(target, "app/a.txt")))
+	assert.Equal(t, "b", readFile(t, path.Join(target, "app/b.txt")))
+	assert.Equal(t, "new", readFile(t, path.Join(target, "app/data/new.txt")))
+	assert.NoFileExists(t, path.Join(target, "app/lower.txt"))
+	assert.NoFileExists(t, path.Join(target, "app/data/lower.txt"))
+}
+
+func Test_OCI_WithSubPath(t *testing.T) {
+	layout := createOCILayout(t, "v1", ociLayers()...)
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	opts := InstallOptions{KeepN: 3, LockTimeout: time.Second}
+	opts.SubPath = "app/cache"
+	id, err := Install(workspace, NewOCISource(layout+":v1"), opts, io.Discard)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(path.Join(workspace, id))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].Name())
+}
+
+func Test_OCI_ShouldRejectInvalidImages(t *testing.T) {
+	layout := createOCILayout(t, "v1", ociLayers()...)
+	assert.ErrorContains(t, Check(NewOCISource(layout+":v2"), ExtractOptions{}, io.Discard), "image v2 not found")
+
+	// a whiteout that points outside of the image
+	escaping := createOCILayout(t, "v1", []testEntry{{name: "app/../../.wh.etc"}})
+	assert.ErrorContains(t, Check(NewOCISource(escaping), ExtractOptions{}, io.Discard), "unsafe entry")
+
+	// a corrupt blob
+	corrupt := createOCILayout(t, "v1", ociLayers()...)
+	blobs, err := os.ReadDir(path.Join(corrupt, "blobs/sha256"))
+	require.NoError(t, err)
+	for _, b := range blobs {
+		require.NoError(t, os.WriteFile(path.Join(corrupt, "blobs/sha256", b.Name()), []byte("{}"), 0644))
+	}
+	assert.ErrorContains(t, Check(NewOCISource(corrupt), ExtractOptions{}, io.Discard), "does not match its digest")
+
+	// an image without layers
+	empty := createOCILayout(t, "v1")
+	assert.ErrorContains(t, Check(NewOCISource(empty), ExtractOptions{}, io.Discard), "has no layers")
+
+	// a manifest that is not an OCI image manifest (e.g. a docker manifest list)
+	unsupported := uuid.NewString()
+	t.Cleanup(func() { os.RemoveAll(unsupported) })
+	mediaType := "application/vnd.docker.distribution.manifest.list.v2+json"
+	contents, err := json.Marshal(ociManifest{MediaType: mediaType, Manifests: []ociDescriptor{}})
+	require.NoError(t, err)
+	d := writeBlob(t, unsupported, mediaType, contents)
+	contents, err = json.Marshal(ociManifest{Manifests: []ociDescriptor{d}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(unsupported, "index.json"), contents, 0644))
+	assert.ErrorContains(t, Check(NewOCISource(unsupported), ExtractOptions{}, io.Discard), "unsupported media type \""+mediaType+"\"")
+}
+
+func Test_OCI_UpperLayersShouldChangeModeOfDirectories(t *testing.T) {
+	layout := createOCILayout(t, "v1",
+		[]testEntry{
+			{name: "app/", typeflag: tar.TypeDir, mode: os.ModeDir | 0755},
+			{name: "app/a.txt", body: "a"},
+		},
+		[]testEntry{
+			{name: "app/", typeflag: tar.TypeDir, mode: os.ModeDir | 0700},
+		},
+	)
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	id, err := Install(workspace, NewOCISource(layout), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+	require.NoError(t, err)
+	info, err := os.Stat(path.Join(workspace, id, "app"))
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0700, info.Mode())
+	assert.Equal(t, "a", readFile(t, path.Join(workspace, id, "app/a.txt")))
+}
+
+func Test_OCI_ShouldSelectPlatform(t *testing.T) {
+	manifests := []ociDescriptor{
+		{Digest: "other", Platform: &ociPlatform{OS: "plan9", Architecture: "mips"}},
+		{Digest: "current", Platform: &ociPlatform{OS: runtime.GOOS, Architecture: runtime.GOARCH}},
+	}
+
+	d, err := selectManifest(manifests, "")
+	require.NoError(t, err)
+	assert.Equal(t, "current", d.Digest)
+
+	_, err = selectManifest(manifests[:1], "")
+	assert.ErrorContains(t, err, "no image found for")
+}
+
+func Test_NewOCISource_ShouldParseTag(t *testing.T) {
+	assert.Equal(t, &ociSource{layout: "/images/app", tag: "1.2.3"}, NewOCISource("/images/app:1.2.3"))
+	assert.Equal(t, &ociSource{layout: "/images/app"}, NewOCISource("/images/app"))
+	assert.Equal(t, &ociSource{layout: `C:\images\app`}, NewOCISource(`C:\images\app`))
+}
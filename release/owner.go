@@ -0,0 +1,72 @@
+package release
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// overridden by tests that need to pretend that they're not running as root
+var geteuid = os.Geteuid
+
+// make sure that we're allowed to give away the extracted files
+// when the ownership recorded in the archive is to be preserved
+func checkPreserveOwner(opts ExtractOptions) error {
+	if opts.PreserveOwner && geteuid() != 0 {
+		return errors.New("preserving the ownership of archive entries requires running as root")
+	}
+	return nil
+}
+
+// return the uid and gid that an entry with the recorded `owner` should be
+// extracted with; the entry's user and group names take precedence over
+// the numeric ids if they exist in the local user database (like tar(1) does)
+func (t *target) owner(owner *Owner) (int, int) {
+	if !t.opts.PreserveOwner || owner == nil {
+		return t.uid, t.gid
+	}
+	t.ownersMu.Lock()
+	defer t.ownersMu.Unlock()
+	uid := lookupID(t.userIDs, owner.Uname, owner.Uid, lookupUserID)
+	gid := lookupID(t.groupIDs, owner.Gname, owner.Gid, lookupGroupID)
+	return uid, gid
+}
+
+func lookupUserID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGroupID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// map `name` to a local id using `lookup` (caching the result in `cache`)
+// or return the `fallback` id if the name is empty or unknown
+func lookupID(cache map[string]int, name string, fallback int, lookup func(string) (string, error)) int {
+	if name == "" {
+		return fallback
+	}
+	if id, ok := cache[name]; ok {
+		if id < 0 {
+			return fallback
+		}
+		return id
+	}
+	cache[name] = -1
+	if s, err := lookup(name); err == nil {
+		if id, err := strconv.Atoi(s); err == nil {
+			cache[name] = id
+			return id
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,86 @@
+//go:build !windows
+
+package release
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// return the uid and gid of the file at `p`
+func fileOwner(t *testing.T, p string) (int, int) {
+	info, err := os.Lstat(p)
+	require.NoError(t, err)
+	st := info.Sys().(*syscall.Stat_t)
+	return int(st.Uid), int(st.Gid)
+}
+
+func Test_Decompression_WithPreserveOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root privileges")
+	}
+	archive := createTarGz(t, []testEntry{
+		{name: "data/", typeflag: tar.TypeDir, mode: 0755, uid: 1234, gid: 5678},
+		{name: "data/app.db", body: "db", uid: 1234, gid: 5678},
+		{name: "data/link", typeflag: tar.TypeSymlink, linkname: "app.db", uid: 2345, gid: 6789},
+		// names that exist in the local user database take precedence over ids
+		{name: "helper", body: "helper", uid: 4321, gid: 8765, uname: "root", gname: "root"},
+		// unknown names fall back to the ids
+		{name: "other", body: "other", uid: 4321, gid: 8765, uname: uuid.NewString(), gname: uuid.NewString()},
+	})
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	tt.opts.PreserveOwner = true
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+
+	expected := map[string][2]int{
+		"data":        {1234, 5678},
+		"data/app.db": {1234, 5678},
+		"data/link":   {2345, 6789},
+		"helper":      {0, 0},
+		"other":       {4321, 8765},
+	}
+	for name, owner := range expected {
+		uid, gid := fileOwner(t, path.Join(target, name))
+		assert.Equal(t, owner, [2]int{uid, gid}, name)
+	}
+}
+
+func Test_Decompression_WithoutPreserveOwner(t *testing.T) {
+	archive := createTarGz(t, []testEntry{{name: "helper", body: "helper", uid: 4321, gid: 8765}})
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+
+	uid, gid := fileOwner(t, path.Join(target, "helper"))
+	assert.Equal(t, tt.uid, uid)
+	assert.Equal(t, tt.gid, gid)
+}
+
+func Test_Install_PreserveOwnerRequiresRoot(t *testing.T) {
+	geteuid = func() int { return 1000 }
+	defer func() { geteuid = os.Geteuid }()
+
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+	opts := InstallOptions{KeepN: 3, LockTimeout: time.Second}
+	opts.PreserveOwner = true
+	_, err := Install(workspace, NewArchiveSource("test/foo.tar.gz", "", nil), opts, io.Discard)
+	assert.EqualError(t, err, "preserving the ownership of archive entries requires running as root")
+	assert.NoDirExists(t, workspace)
+}
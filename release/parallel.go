@@ -0,0 +1,49 @@
+package release
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// returned by the workers that stopped because another worker failed
+var errAborted = errors.New("extraction aborted")
+
+// the number of workers used by the target
+func (t *target) workers() int {
+	if t.opts.Jobs > 0 {
+		return t.opts.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+// run the tasks using the target's workers and return the first error
+// a failure stops the workers from picking up more tasks and aborts
+// the extraction of the files that are currently in progress
+func (t *target) Parallel(tasks []func() error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		next     int64 = -1
+	)
+	for w := 0; w < t.workers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !t.aborted.Load() {
+				idx := int(atomic.AddInt64(&next, 1))
+				if idx >= len(tasks) {
+					return
+				}
+				if err := tasks[idx](); err != nil {
+					once.Do(func() { firstErr = err })
+					t.aborted.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
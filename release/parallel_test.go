@@ -0,0 +1,68 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Zip_Decompression_InParallel(t *testing.T) {
+	entries := []testEntry{}
+	for d := 0; d < 10; d++ {
+		entries = append(entries, testEntry{name: fmt.Sprintf("dir%d/", d), mode: os.ModeDir | 0755})
+		for f := 0; f < 50; f++ {
+			entries = append(entries, testEntry{
+				name: fmt.Sprintf("dir%d/file%d.txt", d, f),
+				body: strings.Repeat(fmt.Sprint(f), 100*f),
+			})
+		}
+	}
+	entries = append(entries, testEntry{name: "link", mode: os.ModeSymlink | 0777, linkname: "dir9/file49.txt"})
+	archive := createZip(t, entries)
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	tt.opts.Jobs = 8
+
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+	for _, e := range entries {
+		if e.mode&os.ModeDir != 0 || e.mode&os.ModeSymlink != 0 {
+			continue
+		}
+		contents, err := os.ReadFile(path.Join(target, e.name))
+		require.NoError(t, err)
+		assert.Equal(t, e.body, string(contents))
+	}
+	assert.FileExists(t, path.Join(target, "link"))
+}
+
+func Test_Zip_Decompression_InParallel_ShouldStopOnFirstError(t *testing.T) {
+	entries := []testEntry{}
+	for f := 0; f < 200; f++ {
+		entries = append(entries, testEntry{name: fmt.Sprintf("file%d.txt", f), body: "foo"})
+	}
+	archive := createZip(t, entries)
+
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	defer os.RemoveAll(target)
+	tt := testTarget(t, target)
+	tt.opts.Jobs = 8
+	// the limit is exceeded by the 101st file
+	tt.opts.Limits.MaxTotalSize = 300
+
+	err := decompressArchive(archive, "", nil, tt)
+	assert.EqualError(t, err, "archive exceeds the maximum extracted size (300 bytes)")
+	// the workers stopped picking up files after the failure
+	extracted, err := os.ReadDir(target)
+	require.NoError(t, err)
+	assert.Less(t, len(extracted), len(entries))
+}
@@ -0,0 +1,84 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// the bits that are stripped from the modes of the extracted entries
+// unless they are explicitly allowed
+var sanitizedBits = []struct {
+	bit  os.FileMode
+	name string
+}{
+	{os.ModeSetuid, "setuid"},
+	{os.ModeSetgid, "setgid"},
+	{os.ModeSticky, "sticky"},
+	{0002, "world-write"},
+}
+
+const specialBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// the number of entries from which each bit was stripped
+type strippedBits struct {
+	mu     sync.Mutex
+	counts map[os.FileMode]int
+}
+
+// apply the permission policy to the `mode` of the entry `name` and
+// return the mode that the entry should be extracted with
+// (links have no permissions of their own, so the policy does not apply to them)
+func (t *target) permissions(name string, mode os.FileMode) os.FileMode {
+	for _, b := range sanitizedBits {
+		if mode&b.bit == 0 {
+			continue
+		}
+		if b.bit&specialBits != 0 && t.opts.AllowSpecialBits {
+			continue
+		}
+		if b.bit == 0002 && t.opts.AllowWorldWritable {
+			continue
+		}
+		mode &^= b.bit
+		t.stripped.mu.Lock()
+		if t.stripped.counts == nil {
+			t.stripped.counts = map[os.FileMode]int{}
+		}
+		t.stripped.counts[b.bit]++
+		t.stripped.mu.Unlock()
+	}
+	if t.opts.Umask != nil {
+		mode &^= *t.opts.Umask & os.ModePerm
+	}
+	return mode
+}
+
+// set the mode of the extracted file at `p` explicitly when the mode
+// that it was created with may have been altered, i.e. by the process
+// umask (if a umask is forced) or by chown(2) (which clears setuid/setgid)
+func (t *target) setMode(p string, mode os.FileMode) error {
+	if t.opts.Umask == nil && mode&specialBits == 0 {
+		return nil
+	}
+	return os.Chmod(p, mode)
+}
+
+// describe the permission bits that were stripped during the extraction
+// (or return an empty string if nothing was stripped)
+func (t *target) strippedSummary() string {
+	t.stripped.mu.Lock()
+	defer t.stripped.mu.Unlock()
+	var parts []string
+	for _, b := range sanitizedBits {
+		n := t.stripped.counts[b.bit]
+		switch {
+		case n == 1:
+			parts = append(parts, fmt.Sprintf("%s (1 entry)", b.name))
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%s (%d entries)", b.name, n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
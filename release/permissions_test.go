@@ -0,0 +1,124 @@
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entries with all the permission bits that are sanitized by default
+func dangerousEntries() []testEntry {
+	return []testEntry{
+		{name: "shared/", typeflag: tar.TypeDir, mode: os.ModeDir | os.ModeSticky | 0777},
+		{name: "shared/helper", body: "helper", mode: os.ModeSetuid | os.ModeSetgid | 0755},
+		{name: "shared/data.txt", body: "data", mode: 0666},
+	}
+}
+
+// extract `archive` to a new directory with the given options
+// and return the modes of the extracted entries
+func extractModes(t *testing.T, archive string, opts func(*ExtractOptions)) (*target, map[string]os.FileMode) {
+	target := uuid.NewString()
+	require.NoError(t, os.Mkdir(target, 0755))
+	t.Cleanup(func() { os.RemoveAll(target) })
+	tt := testTarget(t, target)
+	opts(&tt.opts)
+	require.NoError(t, decompressArchive(archive, "", nil, tt))
+
+	modes := map[string]os.FileMode{}
+	for _, name := range []string{"shared", "shared/helper", "shared/data.txt"} {
+		info, err := os.Stat(path.Join(target, name))
+		require.NoError(t, err)
+		modes[name] = info.Mode()
+	}
+	return tt, modes
+}
+
+func Test_Decompression_ShouldStripDangerousPermissionBits(t *testing.T) {
+	for _, archive := range []string{createTarGz(t, dangerousEntries()), createZip(t, dangerousEntries())} {
+		umask := os.FileMode(0)
+		tt, modes := extractModes(t, archive, func(opts *ExtractOptions) { opts.Umask = &umask })
+
+		assert.Equal(t, os.ModeDir|0775, modes["shared"], archive)
+		assert.Equal(t, os.FileMode(0755), modes["shared/helper"], archive)
+		assert.Equal(t, os.FileMode(0664), modes["shared/data.txt"], archive)
+		assert.Equal(t, "setuid (1 entry), setgid (1 entry), sticky (1 entry), world-write (2 entries)", tt.strippedSummary())
+	}
+}
+
+func Test_Decompression_WithAllowedPermissionBits(t *testing.T) {
+	for _, archive := range []string{createTarGz(t, dangerousEntries()), createZip(t, dangerousEntries())} {
+		umask := os.FileMode(0)
+		tt, modes := extractModes(t, archive, func(opts *ExtractOptions) {
+			opts.AllowSpecialBits = true
+			opts.AllowWorldWritable = true
+			opts.Umask = &umask
+		})
+
+		assert.Equal(t, os.ModeDir|os.ModeSticky|0777, modes["shared"], archive)
+		assert.Equal(t, os.ModeSetuid|os.ModeSetgid|0755, modes["shared/helper"], archive)
+		assert.Equal(t, os.FileMode(0666), modes["shared/data.txt"], archive)
+		assert.Empty(t, tt.strippedSummary())
+	}
+}
+
+func Test_Decompression_WithUmask(t *testing.T) {
+	umask := os.FileMode(027)
+	_, modes := extractModes(t, createTarGz(t, dangerousEntries()), func(opts *ExtractOptions) { opts.Umask = &umask })
+
+	assert.Equal(t, os.ModeDir|0750, modes["shared"])
+	assert.Equal(t, os.FileMode(0750), modes["shared/helper"])
+	assert.Equal(t, os.FileMode(0640), modes["shared/data.txt"])
+}
+
+func Test_Install_ShouldReportStrippedPermissionBits(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	var out bytes.Buffer
+	archive := createTarGz(t, dangerousEntries())
+	_, err := Install(workspace, NewArchiveSource(archive, "", nil), InstallOptions{KeepN: 3, LockTimeout: time.Second}, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "[release] stripped permission bits: setuid (1 entry), setgid (1 entry), sticky (1 entry), world-write (2 entries)\n")
+}
+
+func Test_Decompression_ShouldNotStripPermissionBitsOfLinks(t *testing.T) {
+	archives := []string{
+		createTarGz(t, []testEntry{
+			{name: "app.js", body: "app", mode: 0644},
+			{name: "index.js", typeflag: tar.TypeSymlink, linkname: "app.js", mode: 0777},
+			{name: "main.js", typeflag: tar.TypeLink, linkname: "app.js", mode: 0777},
+		}),
+		createZip(t, []testEntry{
+			{name: "app.js", body: "app", mode: 0644},
+			{name: "index.js", mode: os.ModeSymlink | 0777, linkname: "app.js"},
+		}),
+	}
+	for _, archive := range archives {
+		target := uuid.NewString()
+		require.NoError(t, os.Mkdir(target, 0755))
+		tt := testTarget(t, target)
+		require.NoError(t, decompressArchive(archive, "", nil, tt))
+		assert.Empty(t, tt.strippedSummary(), archive)
+		os.RemoveAll(target)
+	}
+
+	source := uuid.NewString()
+	defer os.RemoveAll(source)
+	require.NoError(t, os.Mkdir(source, 0755))
+	require.NoError(t, os.WriteFile(path.Join(source, "app.js"), []byte("app"), 0644))
+	require.NoError(t, os.Symlink("app.js", path.Join(source, "index.js")))
+	target := uuid.NewString()
+	defer os.RemoveAll(target)
+	require.NoError(t, os.Mkdir(target, 0755))
+	tt := testTarget(t, target)
+	require.NoError(t, copyDirectory(source, tt))
+	assert.Empty(t, tt.strippedSummary())
+}
@@ -0,0 +1,202 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// how often the progress of an extraction is reported
+// (progress bars are redrawn much more often than log lines are written)
+var (
+	progressBarInterval = 200 * time.Millisecond
+	progressLogInterval = 5 * time.Second
+)
+
+// progress periodically reports the number of entries and bytes that
+// have been extracted to a target, compared to the expected totals
+// (if known); the report is a live bar if `w` is a terminal
+type progress struct {
+	w                        io.Writer
+	t                        *target
+	tty                      bool
+	totalEntries, totalBytes int64
+	// set if the target is a dry-run target (see startCheckProgress)
+	checking bool
+	// set once something has been written
+	reported bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// start reporting the progress of the extraction to `t`; the totals are
+// the ones reported by Check (zero if unknown)
+func startProgress(w io.Writer, t *target, totalEntries, totalBytes int64) *progress {
+	return (&progress{
+		w:            w,
+		t:            t,
+		tty:          isTerminal(w),
+		totalEntries: totalEntries,
+		totalBytes:   totalBytes,
+		done:         make(chan struct{}),
+	}).start()
+}
+
+// start reporting the progress of checking a source with the dry-run
+// target `t`; the totals are not known yet, so the progress is measured
+// in bytes of the archive that have been read (see target.expectArchive)
+func startCheckProgress(w io.Writer, t *target) *progress {
+	return (&progress{
+		w:        w,
+		t:        t,
+		tty:      isTerminal(w),
+		checking: true,
+		done:     make(chan struct{}),
+	}).start()
+}
+
+func (p *progress) start() *progress {
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressBarInterval
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.report()
+			}
+		}
+	}()
+	return p
+}
+
+// stop reporting; a progress bar is completed with the final counts
+func (p *progress) stop() {
+	close(p.done)
+	p.wg.Wait()
+	if p.tty && p.reported {
+		p.report()
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progress) report() {
+	entries := atomic.LoadInt64(&p.t.entries)
+	written := atomic.LoadInt64(&p.t.written)
+	switch {
+	case p.checking && p.tty:
+		read, size := atomic.LoadInt64(&p.t.archiveSize), atomic.LoadInt64(&p.t.archiveTotal)
+		fmt.Fprintf(p.w, "\r%s", p.checkBar(entries, written, read, size))
+	case p.checking:
+		read, size := atomic.LoadInt64(&p.t.archiveSize), atomic.LoadInt64(&p.t.archiveTotal)
+		fmt.Fprintf(p.w, "[check] %s\n", p.checkCounts(entries, written, read, size))
+	case p.tty:
+		fmt.Fprintf(p.w, "\r%s", p.bar(entries, written))
+	default:
+		fmt.Fprintf(p.w, "[progress] %s\n", p.counts(entries, written))
+	}
+	p.reported = true
+}
+
+// e.g. "[=========>          ]  45% 120/300 entries, 1.2GiB/2.6GiB"
+func (p *progress) bar(entries, written int64) string {
+	if p.totalBytes <= 0 {
+		return fmt.Sprintf("[release] %s", p.counts(entries, written))
+	}
+	return fmt.Sprintf("%s %s", drawBar(written, p.totalBytes), p.counts(entries, written))
+}
+
+// e.g. "[=========>          ]  45% 120 entries, 1.2GiB, 460.8MiB/1.0GiB of the archive read"
+func (p *progress) checkBar(entries, written, read, size int64) string {
+	if size <= 0 {
+		return fmt.Sprintf("[check] %s", p.checkCounts(entries, written, read, size))
+	}
+	return fmt.Sprintf("%s %s", drawBar(read, size), p.checkCounts(entries, written, read, size))
+}
+
+// add the size of the archive file at `p` to the total of the archive
+// bytes that are expected to be read (see startCheckProgress)
+func (t *target) expectArchive(p string) {
+	if info, err := os.Stat(p); err == nil {
+		atomic.AddInt64(&t.archiveTotal, info.Size())
+	}
+}
+
+// e.g. "[=========>          ]  45%" for n/total = 0.45
+func drawBar(n, total int64) string {
+	ratio := float64(n) / float64(total)
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * progressBarWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return fmt.Sprintf("[%s] %3.0f%%", bar, ratio*100)
+}
+
+// e.g. "120/300 entries, 1.2GiB/2.6GiB (45%)" or "120 entries, 1.2GiB"
+func (p *progress) counts(entries, written int64) string {
+	if p.totalEntries <= 0 {
+		return fmt.Sprintf("%d entries, %s", entries, formatSize(written))
+	}
+	s := fmt.Sprintf("%d/%d entries, %s/%s", entries, p.totalEntries, formatSize(written), formatSize(p.totalBytes))
+	if !p.tty && p.totalBytes > 0 {
+		s += fmt.Sprintf(" (%.0f%%)", 100*float64(written)/float64(p.totalBytes))
+	}
+	return s
+}
+
+// e.g. "120 entries, 1.2GiB, 460.8MiB/1.0GiB of the archive read (45%)"
+// or "120 entries, 1.2GiB" (if no archive is read, e.g. for directories)
+func (p *progress) checkCounts(entries, written, read, size int64) string {
+	s := fmt.Sprintf("%d entries, %s", entries, formatSize(written))
+	switch {
+	case size > 0:
+		s += fmt.Sprintf(", %s/%s of the archive read", formatSize(read), formatSize(size))
+		if !p.tty {
+			s += fmt.Sprintf(" (%.0f%%)", 100*float64(read)/float64(size))
+		}
+	case read > 0:
+		s += fmt.Sprintf(", %s of the archive read", formatSize(read))
+	}
+	return s
+}
+
+// format a number of bytes using binary units
+func formatSize(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, "KMGT"[exp])
+}
+
+// is `w` a terminal (in which case progress is drawn as a bar)?
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,101 @@
+package release
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a reader that takes its time
+type slowReader struct {
+	r io.Reader
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if len(p) > 64 {
+		p = p[:64]
+	}
+	return s.r.Read(p)
+}
+
+func Test_Progress_Bar(t *testing.T) {
+	p := &progress{tty: true, totalEntries: 300, totalBytes: 4 << 30}
+	assert.Equal(t, "[===============>              ]  50% 120/300 entries, 2.0GiB/4.0GiB", p.bar(120, 2<<30))
+	assert.Equal(t, "[==============================] 100% 300/300 entries, 4.0GiB/4.0GiB", p.bar(300, 4<<30))
+
+	// unknown totals
+	p = &progress{tty: true}
+	assert.Equal(t, "[release] 120 entries, 1.5MiB", p.bar(120, 3<<19))
+}
+
+func Test_Progress_Counts(t *testing.T) {
+	p := &progress{totalEntries: 300, totalBytes: 2048}
+	assert.Equal(t, "120/300 entries, 512B/2.0KiB (25%)", p.counts(120, 512))
+	p = &progress{}
+	assert.Equal(t, "120 entries, 512B", p.counts(120, 512))
+}
+
+func Test_Install_ShouldReportProgress(t *testing.T) {
+	progressLogInterval = 5 * time.Millisecond
+	defer func() { progressLogInterval = 5 * time.Second }()
+
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	entries := []testEntry{}
+	for i := 0; i < 20; i++ {
+		entries = append(entries, testEntry{name: uuid.NewString(), body: strings.Repeat("x", 1000)})
+	}
+	archive, err := os.ReadFile(createTarGz(t, entries))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	stdin := &slowReader{r: bytes.NewReader(archive)}
+	_, err = Install(workspace, NewArchiveSource(StdinPath, "", stdin), InstallOptions{KeepN: 3, LockTimeout: time.Second}, &out)
+	require.NoError(t, err)
+	assert.Regexp(t, `\[progress\] \d+ entries, \d+(\.\d)?K?i?B\n`, out.String())
+}
+
+func Test_Progress_Check(t *testing.T) {
+	p := &progress{checking: true}
+	assert.Equal(t, "120 entries, 2.0KiB, 512B/1.0KiB of the archive read (50%)", p.checkCounts(120, 2048, 512, 1024))
+	assert.Equal(t, "120 entries, 2.0KiB, 512B of the archive read", p.checkCounts(120, 2048, 512, 0))
+	assert.Equal(t, "120 entries, 2.0KiB", p.checkCounts(120, 2048, 0, 0))
+
+	p = &progress{checking: true, tty: true}
+	assert.Equal(t, "[===============>              ]  50% 120 entries, 2.0KiB, 512B/1.0KiB of the archive read", p.checkBar(120, 2048, 512, 1024))
+	assert.Equal(t, "[check] 120 entries, 2.0KiB", p.checkBar(120, 2048, 0, 0))
+}
+
+func Test_Check_ShouldReportProgress(t *testing.T) {
+	progressLogInterval = 5 * time.Millisecond
+	defer func() { progressLogInterval = 5 * time.Second }()
+
+	entries := []testEntry{}
+	for i := 0; i < 20; i++ {
+		entries = append(entries, testEntry{name: uuid.NewString(), body: strings.Repeat("x", 1000)})
+	}
+	archivePath := createTarGz(t, entries)
+	archive, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	// the archive is read while being checked
+	var out bytes.Buffer
+	stdin := &slowReader{r: bytes.NewReader(archive)}
+	require.NoError(t, Check(NewArchiveSource(StdinPath, "", stdin), ExtractOptions{}, &out))
+	assert.Regexp(t, `\[check\] \d+ entries, \d+(\.\d)?K?i?B, \d+(\.\d)?K?i?B of the archive read\n`, out.String())
+
+	// the archive's size is known when it is read from a file
+	tt := newDryRunTarget(ExtractOptions{})
+	require.NoError(t, NewArchiveSource(archivePath, "", nil).check(tt))
+	assert.Equal(t, int64(len(archive)), tt.archiveTotal)
+	assert.Equal(t, tt.archiveTotal, tt.archiveSize)
+}
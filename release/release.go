@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -17,28 +18,86 @@ import (
 const (
 	ReleaseFormat   = "20060102150405.000"
 	CurrentLinkName = "current"
+	// releases are extracted under this directory (inside the workspace's
+	// metadata directory) and moved into place when complete
+	stagingDirName = "staging"
 )
 
 var ReleaseFormatRe = regexp.MustCompile(`\b\d{14}\.\d{3}\b`)
 
-// Execute the release flow given a workspace directory and a zip file (bundle)
-// If the username is empty, then the current user/group is used
+// InstallOptions control how a bundle is released into a workspace
+type InstallOptions struct {
+	// the maximum number of releases to keep in the workspace
+	KeepN uint
+	// the owners of the extracted files
+	// if empty, then the current user (and their group) are used
+	Username, Groupname string
+	// the maximum time to wait for other operations on the workspace to finish
+	LockTimeout time.Duration
+	ExtractOptions
+}
+
+// ExtractOptions control how the contents of a source are extracted to a release
+type ExtractOptions struct {
+	// the limits that the bundle's contents must respect (see DefaultLimits)
+	Limits Limits
+	// the number of leading path components to remove from archive entries
+	// (entries with fewer components are skipped), like tar's --strip-components
+	StripComponents int
+	// extract only the entries under this (archive) path, which becomes
+	// the release directory (applied after StripComponents)
+	SubPath string
+	// if the release ends up containing a single directory,
+	// then move that directory's contents to the release directory
+	AutoUnwrap bool
+	// glob patterns of the entries to extract (all if empty) and to skip
+	// (see matchesAny for how the patterns are matched)
+	Include, Exclude []string
+	// the number of files that are extracted concurrently from archives
+	// that support random access, i.e. zip (defaults to the number of CPUs)
+	Jobs int
+	// do not preserve the modification times recorded in the archive
+	// (extracted files will have the time of extraction instead)
+	Touch bool
+	// use the ownership recorded in the entries of tar archives instead of
+	// the resolved user and group (requires running as root)
+	PreserveOwner bool
+	// keep the setuid, setgid and sticky bits of the extracted entries
+	// (they are stripped by default)
+	AllowSpecialBits bool
+	// keep the world-writable bit of the extracted entries
+	// (it is stripped by default)
+	AllowWorldWritable bool
+	// if not nil, the extracted entries' modes are masked with this umask
+	// instead of the process umask
+	Umask *os.FileMode
+}
+
+// Execute the release flow given a workspace directory and a source (e.g. an archive file)
 // Steps:
-// 1. create the workspace if necessary
-// 2. resolve the uid and gid of the files to be created
-// 3. create the release directory inside the workspace
-// 4. decompress the bundle into the release directory
-// 5. update the workspace's `current` link to point to the new release
-// 6. apply the policy of how many releases to keep
+// 1. check the source's contents (unless the source is streamed)
+// 2. create the workspace if necessary and lock it
+// 3. resolve the uid and gid of the files to be created
+// 4. create a staging directory for the release inside the workspace
+// 5. unpack the source into the staging directory
+// 6. move the staging directory to the release directory
+// 7. update the workspace's `current` link to point to the new release
+// 8. apply the policy of how many releases to keep
 //
 // The function returns the ID of the release (directory name) and/or an error
 // if the ID is not an empty string, then the release directory still exists (even on error) and can be used
-func Install(workspaceDir, bundlePath string, keepN uint, username, groupname string, stdout io.Writer) (string, error) {
+func Install(workspaceDir string, src Source, opts InstallOptions, stdout io.Writer) (string, error) {
 	// we should not accept this value because
 	// it will leave us with no releases at all
-	if keepN == 0 {
+	if opts.KeepN == 0 {
 		return "", errors.New("can not accept keeping no releases in the workspace")
 	}
+	if err := validatePatterns(append(opts.Include, opts.Exclude...)); err != nil {
+		return "", err
+	}
+	if err := checkPreserveOwner(opts.ExtractOptions); err != nil {
+		return "", err
+	}
 	// we will work with absolute directories
 	if !path.IsAbs(workspaceDir) {
 		cwd, err := os.Getwd()
@@ -50,48 +109,125 @@ func Install(workspaceDir, bundlePath string, keepN uint, username, groupname st
 	}
 	fmt.Fprintf(stdout, "[info] workspace=%s\n", workspaceDir)
 
+	// validate the source before touching the workspace
+	// (streamed sources are validated while being extracted)
+	// the totals are used for reporting the extraction's progress
+	var totalEntries, totalBytes int64
+	if u, ok := src.(*urlSource); ok {
+		// downloaded archives are kept only for the duration of the release
+		defer u.remove()
+	}
+	if !src.streamed() {
+		checked, err := check(src, opts.ExtractOptions, stdout)
+		if err != nil {
+			return "", err
+		}
+		totalEntries, totalBytes = checked.entries, checked.written
+	}
+
+	lock, err := lockWorkspace(workspaceDir, opts.LockTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Unlock()
+
 	// figure out file/directory ownership
-	uid, gid, err := resolveUser(username)
+	uid, gid, err := resolveUser(opts.Username)
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve user: %v", err)
 	}
-	if groupname != "" {
-		gid, err = resolveGroup(groupname)
+	if opts.Groupname != "" {
+		gid, err = resolveGroup(opts.Groupname)
 		if err != nil {
 			return "", fmt.Errorf("failed to resolve group: %v", err)
 		}
 	}
 
-	// create release under workspace
+	// remove any staged releases left behind by interrupted invocations
+	// (we hold the lock, so no one else can be using them)
+	stagingRoot := path.Join(workspaceDir, MetadataDirName, stagingDirName)
+	if err := os.RemoveAll(stagingRoot); err != nil {
+		return "", fmt.Errorf("failed to clean up staging area: %v", err)
+	}
+
+	// create release under the workspace's staging area
 	id := time.Now().Format(ReleaseFormat)
 	releaseDir := path.Join(workspaceDir, id)
-	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+	stagingDir := path.Join(stagingRoot, id)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create release: %v", err)
 	}
 	fmt.Fprintf(stdout, "[info] release=%s\n", id)
-	// decompress bundle file
-	fmt.Fprintf(stdout, "[release] unpacking bundle=%s to %s\n", bundlePath, releaseDir)
-	if err := decompressArchive(bundlePath, releaseDir, uid, gid); err != nil {
-		// cleanup release directory
+	// unpack the source
+	fmt.Fprintf(stdout, "[release] unpacking %s to %s\n", src, stagingDir)
+	t := newTarget(stagingDir, uid, gid, opts.ExtractOptions)
+	p := startProgress(stdout, t, totalEntries, totalBytes)
+	err = src.populate(t)
+	p.stop()
+	if err != nil {
+		// cleanup staging directory
+		defer os.RemoveAll(stagingDir)
+		return "", err
+	}
+	if t.commit != "" {
+		fmt.Fprintf(stdout, "[release] commit=%s\n", t.commit)
+	}
+	if stripped := t.strippedSummary(); stripped != "" {
+		fmt.Fprintf(stdout, "[release] stripped permission bits: %s\n", stripped)
+	}
+	if opts.AutoUnwrap {
+		top, err := t.unwrap()
+		if err != nil {
+			defer os.RemoveAll(stagingDir)
+			return "", fmt.Errorf("failed to unwrap release: %v", err)
+		}
+		if top != "" {
+			fmt.Fprintf(stdout, "[release] unwrapped top-level directory %s\n", top)
+		}
+	}
+	// the release becomes visible only after it is complete and persisted
+	if err := syncDirectories(stagingDir); err != nil {
+		defer os.RemoveAll(stagingDir)
+		return "", fmt.Errorf("failed to sync release: %v", err)
+	}
+	fmt.Fprintf(stdout, "[release] moving release to %s\n", releaseDir)
+	if err := os.Rename(stagingDir, releaseDir); err != nil {
+		defer os.RemoveAll(stagingDir)
+		return "", fmt.Errorf("failed to move release into place: %v", err)
+	}
+	if err := syncDir(workspaceDir); err != nil {
 		defer os.RemoveAll(releaseDir)
-		return "", fmt.Errorf("failed to decompress archive: %v", err)
+		return "", fmt.Errorf("failed to sync workspace: %v", err)
+	}
+	if err := writeReleaseInfo(workspaceDir, id, releaseInfo{Source: src.String(), Commit: t.commit}); err != nil {
+		defer removeRelease(workspaceDir, id)
+		return "", fmt.Errorf("failed to record release information: %v", err)
 	}
 
 	// update current link
 	fmt.Fprintf(stdout, "[release] updating current to %s\n", id)
 	if err := createOrUpdateLink(workspaceDir, id); err != nil {
 		// cleanup release directory
-		defer os.RemoveAll(releaseDir)
+		defer removeRelease(workspaceDir, id)
 		return "", fmt.Errorf("failed to create/update link: %v", err)
 	}
 	// clean up excess releases
-	if err := cleanupReleases(workspaceDir, keepN, stdout); err != nil {
-		return id, fmt.Errorf("failed to clean up releases (keep=%d)", keepN)
+	if err := cleanupReleases(workspaceDir, opts.KeepN, stdout); err != nil {
+		return id, fmt.Errorf("failed to clean up releases (keep=%d)", opts.KeepN)
 	}
 	return id, nil
 }
 
-func Rewind(workspaceDir, target string, stdout io.Writer) (string, error) {
+func Rewind(workspaceDir, target string, lockTimeout time.Duration, stdout io.Writer) (string, error) {
+	if _, err := os.Stat(workspaceDir); err != nil {
+		return target, err
+	}
+	lock, err := lockWorkspace(workspaceDir, lockTimeout)
+	if err != nil {
+		return target, err
+	}
+	defer lock.Unlock()
+
 	releases, err := getReleasesDesc(workspaceDir)
 	if err != nil {
 		return target, err
@@ -136,10 +272,9 @@ func Rewind(workspaceDir, target string, stdout io.Writer) (string, error) {
 		if rel == target {
 			break
 		}
-		releasePath := path.Join(workspaceDir, rel)
 		fmt.Fprintf(stdout, "[cleanup] deleting %s\n", rel)
-		if err := os.RemoveAll(releasePath); err != nil {
-			return target, fmt.Errorf("failed to delete release %s: %v", releasePath, err)
+		if err := removeRelease(workspaceDir, rel); err != nil {
+			return target, err
 		}
 	}
 
@@ -155,10 +290,14 @@ func List(workspaceDir string) ([]string, error) {
 	if err != nil {
 		return releases, fmt.Errorf("failed to resolve current release: %v", err)
 	}
-	// mark current release
 	for idx, rel := range releases {
+		// show the commit of releases exported from git
+		if info, err := readReleaseInfo(workspaceDir, rel); err == nil && info != nil && info.Commit != "" {
+			releases[idx] += " commit=" + info.Commit
+		}
+		// mark current release
 		if rel == current {
-			releases[idx] = rel + " <== current"
+			releases[idx] += " <== current"
 		}
 	}
 
@@ -175,10 +314,9 @@ func cleanupReleases(workspaceDir string, keepN uint, stdout io.Writer) error {
 	if obsoleteN > 0 {
 		for idx, releaseName := range releases {
 			if idx < obsoleteN {
-				releasePath := path.Join(workspaceDir, releaseName)
 				fmt.Fprintf(stdout, "[cleanup] deleting %s (keep=%d)\n", releaseName, keepN)
-				if err := os.RemoveAll(releasePath); err != nil {
-					return fmt.Errorf("failed to delete release %s: %v", releasePath, err)
+				if err := removeRelease(workspaceDir, releaseName); err != nil {
+					return err
 				}
 			}
 		}
@@ -228,17 +366,21 @@ func getReleases(workspaceDir string) ([]string, error) {
 
 func createOrUpdateLink(workspaceDir, target string) error {
 	link := path.Join(workspaceDir, CurrentLinkName)
-	// does the link already exist?
-	_, err := os.Stat(link)
-	if !os.IsNotExist(err) {
-		if err := os.Remove(link); err != nil {
-			return fmt.Errorf("update failed: %v", err)
-		}
+	// create the new link under a temporary name and then rename it over
+	// the existing one; rename(2) is atomic so readers of the `current` link
+	// will always find either the old or the new release (never nothing)
+	tmpLink := path.Join(workspaceDir, fmt.Sprintf(".%s.%d.tmp", CurrentLinkName, os.Getpid()))
+	// remove any leftovers from a previously interrupted update
+	if err := os.Remove(tmpLink); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("create failed: %v", err)
 	}
-	// TODO: what if the following fails? We are stuck with no `current` link
-	if err := os.Symlink(target, link); err != nil {
+	if err := os.Symlink(target, tmpLink); err != nil {
 		return fmt.Errorf("create failed: %v", err)
 	}
+	if err := os.Rename(tmpLink, link); err != nil {
+		os.Remove(tmpLink)
+		return fmt.Errorf("update failed: %v", err)
+	}
 	return nil
 }
 
@@ -280,6 +422,29 @@ func resolveGroup(groupname string) (gid int, err error) {
 	return
 }
 
+// fsync all the directories under (and including) `root` so that
+// their entries are persisted; regular files are synced when created
+func syncDirectories(root string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return syncDir(p)
+	})
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil || !os.IsNotExist(err)
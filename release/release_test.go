@@ -0,0 +1,141 @@
+package release
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchCurrent starts `n` readers that keep resolving a file through the
+// workspace's `current` link until the returned function is called;
+// the latter returns the number of failed lookups, i.e. the times that the
+// link was missing or that the release it pointed to did not contain the file
+// (unless the release was no longer current, since it may have been deleted)
+func watchCurrent(workspace, file string, n int) func() int {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures int
+		done     = make(chan struct{})
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if !lookup(workspace, file) {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	return func() int {
+		close(done)
+		wg.Wait()
+		return failures
+	}
+}
+
+// resolve `file` through the workspace's `current` link
+func lookup(workspace, file string) bool {
+	target, err := os.Readlink(path.Join(workspace, CurrentLinkName))
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(path.Join(workspace, target, file)); err != nil {
+		// a rewind deletes the previous release after the link is swapped
+		after, lerr := GetCurrent(workspace)
+		return lerr == nil && os.IsNotExist(err) && after != target
+	}
+	return true
+}
+
+func Test_Install_CurrentIsAlwaysResolvable(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	_, err := Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+	require.NoError(t, err)
+
+	stop := watchCurrent(workspace, "foo/bar.txt", 8)
+	for i := 0; i < 20; i++ {
+		time.Sleep(2 * time.Millisecond)
+		_, err := Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+		require.NoError(t, err)
+	}
+	assert.Zero(t, stop())
+}
+
+func Test_Rewind_CurrentIsAlwaysResolvable(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	for i := 0; i < 20; i++ {
+		time.Sleep(2 * time.Millisecond)
+		_, err := Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 20, LockTimeout: time.Second}, io.Discard)
+		require.NoError(t, err)
+	}
+
+	stop := watchCurrent(workspace, "foo/bar.txt", 8)
+	for i := 0; i < 19; i++ {
+		_, err := Rewind(workspace, "", time.Second, io.Discard)
+		require.NoError(t, err)
+	}
+	assert.Zero(t, stop())
+
+	releases, err := getReleases(workspace)
+	require.NoError(t, err)
+	assert.Len(t, releases, 1)
+}
+
+func Test_Install_ShouldNotExposeIncompleteRelease(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	// a truncated copy of a valid bundle (streamed, so that it's not checked in advance)
+	contents, err := os.ReadFile("test/foo.tar.gz")
+	require.NoError(t, err)
+	stdin := bytes.NewReader(contents[:len(contents)/2])
+
+	_, err = Install(workspace, NewArchiveSource(StdinPath, "", stdin), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+	require.Error(t, err)
+
+	releases, err := getReleases(workspace)
+	require.NoError(t, err)
+	assert.Empty(t, releases)
+	assert.NoFileExists(t, path.Join(workspace, CurrentLinkName))
+	entries, err := os.ReadDir(path.Join(workspace, MetadataDirName, stagingDirName))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func Test_Install_ShouldRemoveLeftoverStagedReleases(t *testing.T) {
+	workspace := uuid.NewString()
+	defer os.RemoveAll(workspace)
+
+	leftover := path.Join(workspace, MetadataDirName, stagingDirName, "20240101000000.000")
+	require.NoError(t, os.MkdirAll(leftover, 0755))
+
+	id, err := Install(workspace, NewArchiveSource("test/foo.zip", "", nil), InstallOptions{KeepN: 3, LockTimeout: time.Second}, io.Discard)
+	require.NoError(t, err)
+
+	assert.NoDirExists(t, leftover)
+	releases, err := getReleases(workspace)
+	require.NoError(t, err)
+	assert.Equal(t, []string{id}, releases)
+}
@@ -0,0 +1,95 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Source provides the contents of a new release
+type Source interface {
+	// describe the source (used in messages)
+	String() string
+	// fill the (empty) release directory `t` with the source's contents
+	populate(t *target) error
+	// validate the source's contents using the dry-run target `t`
+	check(t *target) error
+	// can the source's contents be read only once?
+	streamed() bool
+}
+
+// a source that is an archive file (bundle)
+type archiveSource struct {
+	path, format string
+	stdin        io.Reader
+}
+
+// Create a source from the archive file at `path`
+// If `path` is StdinPath, then the archive will be read from `stdin`
+// If `format` is empty, then it will be detected from the archive's contents
+func NewArchiveSource(path, format string, stdin io.Reader) Source {
+	return &archiveSource{path: path, format: format, stdin: stdin}
+}
+
+func (s *archiveSource) String() string {
+	return fmt.Sprintf("bundle=%s", s.path)
+}
+
+func (s *archiveSource) populate(t *target) error {
+	if err := decompressArchive(s.path, s.format, s.stdin, t); err != nil {
+		return fmt.Errorf("failed to decompress archive: %v", err)
+	}
+	return nil
+}
+
+func (s *archiveSource) check(t *target) error {
+	if s.path != StdinPath {
+		t.expectArchive(s.path)
+	}
+	if err := decompressArchive(s.path, s.format, s.stdin, t); err != nil {
+		return fmt.Errorf("invalid archive: %v", err)
+	}
+	return nil
+}
+
+func (s *archiveSource) streamed() bool {
+	return s.path == StdinPath
+}
+
+// a source that is a directory tree
+type directorySource struct {
+	path string
+}
+
+// Create a source from the directory tree under `path`
+func NewDirectorySource(path string) Source {
+	return &directorySource{path: path}
+}
+
+func (s *directorySource) String() string {
+	return fmt.Sprintf("directory=%s", s.path)
+}
+
+func (s *directorySource) populate(t *target) error {
+	if err := copyDirectory(s.path, t); err != nil {
+		return fmt.Errorf("failed to copy directory: %v", err)
+	}
+	return nil
+}
+
+// the directory's contents are not validated (they can change before
+// they're copied anyway), only its existence
+func (s *directorySource) check(t *target) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("invalid directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid directory: %s is not a directory", s.path)
+	}
+	return nil
+}
+
+func (s *directorySource) streamed() bool {
+	return false
+}
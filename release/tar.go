@@ -0,0 +1,85 @@
+package release
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+)
+
+// tarExtractor extracts tar archives that are compressed with a specific method
+type tarExtractor struct {
+	// does the beginning of an archive match the compression's signature?
+	detect func(header []byte) bool
+	// wrap the compressed stream into an uncompressed one
+	decompress func(io.Reader) (io.ReadCloser, error)
+}
+
+func (x tarExtractor) Detect(header []byte) bool {
+	return x.detect(header)
+}
+
+// tar archives are extracted while being streamed
+func (x tarExtractor) Extract(archive Archive, t Target) error {
+	uncompressedStream, err := x.decompress(archive)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %v", err)
+	}
+	defer uncompressedStream.Close()
+
+	return ExtractTar(uncompressedStream, t)
+}
+
+// ExtractTar adds all the entries of the (uncompressed) tar stream to the target
+// It can be used by the extractors of formats that contain tar archives
+func ExtractTar(uncompressedStream io.Reader, t Target) error {
+	tarReader := tar.NewReader(uncompressedStream)
+
+	for true {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to extract file from archive: %v", err)
+		}
+
+		// e.g. the commit id that is recorded by git-archive(1)
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		e := Entry{
+			Name:     header.Name,
+			Mode:     header.FileInfo().Mode() & (os.ModePerm | specialBits),
+			Size:     header.Size,
+			Linkname: header.Linkname,
+			ModTime:  header.ModTime,
+			Owner: &Owner{
+				Uid:   header.Uid,
+				Gid:   header.Gid,
+				Uname: header.Uname,
+				Gname: header.Gname,
+			},
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			e.Type = TypeDir
+		case tar.TypeReg:
+			e.Type = TypeFile
+		case tar.TypeSymlink:
+			e.Type = TypeSymlink
+		case tar.TypeLink:
+			e.Type = TypeHardLink
+		default:
+			return fmt.Errorf("unsupported file type: file=%s type=%d", header.Name, header.Typeflag)
+		}
+		if err := t.Add(e, tarReader); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
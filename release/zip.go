@@ -0,0 +1,135 @@
+package release
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// zipExtractor extracts zip archives
+type zipExtractor struct{}
+
+func (zipExtractor) Detect(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("PK\x03\x04")) ||
+		// an empty archive
+		bytes.HasPrefix(header, []byte("PK\x05\x06"))
+}
+
+// zip archives support random access, so the entries are extracted in
+// three phases: (a) directories, (b) regular files, which are extracted
+// concurrently by the target's workers and (c) symbolic links, so that
+// no file is ever written through a link created by the archive
+func (zipExtractor) Extract(archive Archive, t Target) error {
+	// Open the zip archive for reading
+	ra, size, err := archive.ReaderAt()
+	if err != nil {
+		return err
+	}
+	r, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
+
+	// Sort the archive's entries by type
+	var dirs, files, symlinks []*zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			dirs = append(dirs, f)
+		} else if f.Mode()&os.ModeSymlink != 0 {
+			symlinks = append(symlinks, f)
+		} else {
+			files = append(files, f)
+		}
+	}
+
+	for _, f := range dirs {
+		if err := t.Add(zipEntry(f, TypeDir), nil); err != nil {
+			return err
+		}
+	}
+
+	tasks := make([]func() error, len(files))
+	for idx := range files {
+		f := files[idx]
+		tasks[idx] = func() error {
+			contents := &zipContents{f: f}
+			defer contents.Close()
+			return t.Add(zipEntry(f, TypeFile), contents)
+		}
+	}
+	if err := t.Parallel(tasks); err != nil {
+		return err
+	}
+
+	for _, f := range symlinks {
+		// Symbolic links store their target as the file's contents
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		linkname, err := readZipSymlink(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		e := zipEntry(f, TypeSymlink)
+		e.Linkname = linkname
+		if err := t.Add(e, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// describe the zip archive's file `f` as an entry of type `typ`
+// (zip archives do not record ownership)
+func zipEntry(f *zip.File, typ EntryType) Entry {
+	return Entry{
+		Name:    f.Name,
+		Type:    typ,
+		Mode:    f.Mode() & (os.ModePerm | specialBits),
+		Size:    int64(f.UncompressedSize64),
+		ModTime: f.Modified,
+	}
+}
+
+// zipContents opens the contents of a zip archive's file on the first read
+// so that contents that are not read at all are not decompressed (e.g. the
+// dry-run target validates zip files using their declared sizes)
+type zipContents struct {
+	f  *zip.File
+	rc io.ReadCloser
+}
+
+func (z *zipContents) Read(p []byte) (int, error) {
+	if z.rc == nil {
+		rc, err := z.f.Open()
+		if err != nil {
+			return 0, err
+		}
+		z.rc = rc
+	}
+	return z.rc.Read(p)
+}
+
+func (z *zipContents) Close() error {
+	if z.rc == nil {
+		return nil
+	}
+	return z.rc.Close()
+}
+
+// read the target of a symbolic link stored in a zip archive
+func readZipSymlink(rc io.Reader) (string, error) {
+	linkname, err := io.ReadAll(io.LimitReader(rc, maxSymlinkLength+1))
+	if err != nil {
+		return "", err
+	}
+	if len(linkname) > maxSymlinkLength {
+		return "", errors.New("symbolic link target is too long")
+	}
+	return string(linkname), nil
+}